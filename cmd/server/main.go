@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/ironicbadger/qr-code-generator/internal/handler"
 	"github.com/ironicbadger/qr-code-generator/internal/qrcode"
@@ -20,6 +21,11 @@ func main() {
 	port := getEnv("PORT", "8080")
 	dbPath := getEnv("DB_PATH", "/data/qrcodes.db")
 
+	verify, err := strconv.ParseBool(getEnv("VERIFY_CODES", "true"))
+	if err != nil {
+		log.Fatalf("Invalid VERIFY_CODES: %v", err)
+	}
+
 	// Initialize storage
 	store, err := storage.New(dbPath)
 	if err != nil {
@@ -33,6 +39,7 @@ func main() {
 
 	// Initialize QR generator
 	generator := qrcode.New()
+	generator.SetVerify(verify)
 
 	// Parse templates
 	templates, err := template.ParseFS(templatesFS, "templates/*.html")
@@ -42,6 +49,15 @@ func main() {
 
 	// Initialize handler
 	h := handler.New(store, generator, templates)
+	if base := os.Getenv("BASE_URL"); base != "" {
+		if err := h.SetBaseURL(base); err != nil {
+			log.Fatalf("Invalid BASE_URL: %v", err)
+		}
+	}
+	h.SetIPHashKey(os.Getenv("SCAN_IP_HASH_KEY"))
+	if err := h.SetTrustedProxies(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Setup routes
 	mux := http.NewServeMux()
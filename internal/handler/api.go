@@ -0,0 +1,587 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 100
+	apiMaxBodyBytes = 64 << 10
+)
+
+// apiCode is the JSON representation of a stored code. The image itself is
+// fetched from ImageURL rather than inlined.
+type apiCode struct {
+	ID           int64           `json:"id"`
+	Content      string          `json:"content"`
+	Label        string          `json:"label"`
+	ECLevel      string          `json:"ec_level"`
+	Foreground   string          `json:"foreground"`
+	Background   string          `json:"background"`
+	LogoID       int64           `json:"logo_id,omitempty"`
+	LogoPercent  int             `json:"logo_percent,omitempty"`
+	Size         int             `json:"size"`
+	Margin       int             `json:"margin"`
+	Style        string          `json:"style"`
+	PayloadType  string          `json:"payload_type,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Verification string          `json:"verification"`
+	// Tags and Collections (by ID) organise the history.
+	Tags        []string `json:"tags,omitempty"`
+	Collections []int64  `json:"collections,omitempty"`
+	// Slug, Target, Status and the limits are set for dynamic codes, whose
+	// content is the short link for Slug.
+	Slug      string         `json:"slug,omitempty"`
+	Target    string         `json:"target,omitempty"`
+	Status    string         `json:"status,omitempty"`
+	StartsAt  *time.Time     `json:"starts_at,omitempty"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	MaxScans  int            `json:"max_scans,omitempty"`
+	ScanCount int            `json:"scan_count,omitempty"`
+	Fallback  string         `json:"fallback,omitempty"`
+	Protected bool           `json:"protected,omitempty"`
+	Rules     []redirectRule `json:"rules,omitempty"`
+	ImageURL  string         `json:"image_url"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// toAPICode converts a stored code and, for a dynamic code, its link.
+func toAPICode(code *storage.QRCode, link *storage.Link) apiCode {
+	c := apiCode{
+		ID:           code.ID,
+		Content:      code.Content,
+		Label:        code.Label,
+		ECLevel:      code.ECLevel,
+		Foreground:   code.Foreground,
+		Background:   code.Background,
+		LogoID:       code.LogoID,
+		LogoPercent:  code.LogoPercent,
+		Size:         code.Size,
+		Margin:       code.Margin,
+		Style:        code.Style,
+		PayloadType:  code.PayloadType,
+		Verification: code.Verification,
+		ImageURL:     "/qr/" + strconv.FormatInt(code.ID, 10),
+		CreatedAt:    code.CreatedAt,
+		UpdatedAt:    code.UpdatedAt,
+	}
+	if code.PayloadData != "" {
+		c.Payload = json.RawMessage(code.PayloadData)
+	}
+	if link != nil {
+		c.Slug = link.Slug
+		c.Target = link.Target
+		c.Status = string(link.Status(time.Now()))
+		c.StartsAt = link.StartsAt
+		c.ExpiresAt = link.ExpiresAt
+		c.MaxScans = link.MaxScans
+		c.ScanCount = link.ScanCount
+		c.Fallback = link.Fallback
+		c.Protected = link.PassphraseHash != ""
+		c.Rules = linkRules(link)
+	}
+	return c
+}
+
+// codeUpdate is a partial update; nil fields are left unchanged.
+type codeUpdate struct {
+	Content     *string         `json:"content"`
+	Label       *string         `json:"label"`
+	Level       *string         `json:"level"`
+	Foreground  *string         `json:"foreground"`
+	Background  *string         `json:"background"`
+	LogoID      *int64          `json:"logo_id"`
+	LogoPercent *int            `json:"logo_percent"`
+	Size        *int            `json:"size"`
+	Margin      *int            `json:"margin"`
+	Style       *string         `json:"style"`
+	PayloadType *string         `json:"payload_type"`
+	Payload     json.RawMessage `json:"payload"`
+	// Target and the limits change where and when a dynamic code
+	// redirects; an empty string clears a time or the fallback.
+	Target    *string `json:"target"`
+	StartsAt  *string `json:"starts_at"`
+	ExpiresAt *string `json:"expires_at"`
+	MaxScans  *int    `json:"max_scans"`
+	Fallback  *string `json:"fallback"`
+	// Passphrase replaces the passphrase of a dynamic code; an empty
+	// string removes it.
+	Passphrase *string `json:"passphrase"`
+	// Rules replaces the redirect rules of a dynamic code; an empty list
+	// removes them.
+	Rules *[]redirectRule `json:"rules"`
+	// Tags replaces the tags of a code; an empty list removes them.
+	Tags *[]string `json:"tags"`
+}
+
+// changesLimits reports whether u changes the limits of a dynamic code.
+func (u *codeUpdate) changesLimits() bool {
+	return u.StartsAt != nil || u.ExpiresAt != nil || u.MaxScans != nil || u.Fallback != nil
+}
+
+// applyLimits returns the limits of link with u applied.
+func (u *codeUpdate) applyLimits(link *storage.Link) (storage.LinkLimits, error) {
+	l := formatLimits(link.LinkLimits)
+	if u.StartsAt != nil {
+		l.StartsAt = *u.StartsAt
+	}
+	if u.ExpiresAt != nil {
+		l.ExpiresAt = *u.ExpiresAt
+	}
+	if u.MaxScans != nil {
+		l.MaxScans = *u.MaxScans
+	}
+	if u.Fallback != nil {
+		l.Fallback = *u.Fallback
+	}
+	return l.parse()
+}
+
+// changesContent reports whether u changes what a code encodes.
+func (u *codeUpdate) changesContent() bool {
+	return u.Content != nil || u.PayloadType != nil || u.Payload != nil
+}
+
+func (u *codeUpdate) apply(req *codeRequest) {
+	if u.Content != nil {
+		req.Content = *u.Content
+	}
+	if u.Label != nil {
+		req.Label = *u.Label
+	}
+	if u.Level != nil {
+		req.Level = *u.Level
+	}
+	if u.Foreground != nil {
+		req.Foreground = *u.Foreground
+	}
+	if u.Background != nil {
+		req.Background = *u.Background
+	}
+	if u.LogoID != nil {
+		req.LogoID = *u.LogoID
+	}
+	if u.LogoPercent != nil {
+		req.LogoPercent = *u.LogoPercent
+	}
+	if u.Size != nil {
+		req.Size = *u.Size
+	}
+	if u.Margin != nil {
+		req.Margin = u.Margin
+	}
+	if u.Style != nil {
+		req.Style = *u.Style
+	}
+
+	// New content without a payload turns the code back into plain text.
+	if u.Content != nil && u.PayloadType == nil && u.Payload == nil {
+		req.PayloadType = ""
+		req.Payload = nil
+	}
+	if u.PayloadType != nil {
+		req.PayloadType = *u.PayloadType
+	}
+	if u.Payload != nil {
+		req.Payload = u.Payload
+	}
+}
+
+func (h *Handler) registerAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/codes", h.handleAPICreate)
+	mux.HandleFunc("GET /api/v1/codes", h.handleAPIList)
+	mux.HandleFunc("GET /api/v1/codes/{id}", h.handleAPIGet)
+	mux.HandleFunc("PATCH /api/v1/codes/{id}", h.handleAPIUpdate)
+	mux.HandleFunc("DELETE /api/v1/codes/{id}", h.handleAPIDelete)
+	mux.HandleFunc("GET /api/v1/codes/{id}/scans", h.handleAPIScans)
+	mux.HandleFunc("GET /api/v1/campaigns", h.handleAPICampaigns)
+	mux.HandleFunc("GET /api/v1/utm-presets", h.handleAPIPresets)
+	mux.HandleFunc("POST /api/v1/utm-presets", h.handleAPICreatePreset)
+	mux.HandleFunc("DELETE /api/v1/utm-presets/{id}", h.handleAPIDeletePreset)
+	mux.HandleFunc("GET /api/v1/tags", h.handleAPITags)
+	mux.HandleFunc("GET /api/v1/collections", h.handleAPICollections)
+	mux.HandleFunc("POST /api/v1/collections", h.handleAPICreateCollection)
+	mux.HandleFunc("PATCH /api/v1/collections/{id}", h.handleAPIRenameCollection)
+	mux.HandleFunc("DELETE /api/v1/collections/{id}", h.handleAPIDeleteCollection)
+	mux.HandleFunc("PUT /api/v1/collections/{id}/codes/{code_id}", h.handleAPICollectionCode)
+	mux.HandleFunc("DELETE /api/v1/collections/{id}/codes/{code_id}", h.handleAPICollectionCode)
+}
+
+func (h *Handler) handleAPICreate(w http.ResponseWriter, r *http.Request) {
+	var req codeRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ephemeral() {
+		image, err := h.renderEphemeral(&req)
+		if err != nil {
+			status, message := errorStatus(err, "Failed to create QR code")
+			writeJSONError(w, status, message)
+			return
+		}
+		writeEphemeral(w, image)
+		return
+	}
+
+	code, link, err := h.createCode(r, &req)
+	if err != nil {
+		status, message := errorStatus(err, "Failed to create QR code")
+		writeJSONError(w, status, message)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/codes/"+strconv.FormatInt(code.ID, 10))
+	if len(req.Tags) == 0 {
+		writeJSON(w, http.StatusCreated, toAPICode(code, link))
+		return
+	}
+	h.writeAPICode(w, http.StatusCreated, code)
+}
+
+func (h *Handler) handleAPIList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := listFilter(r, "payload_type")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := h.store.List(filter, limit, offset)
+	if err != nil {
+		log.Printf("Error listing QR codes: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list QR codes")
+		return
+	}
+	total, err := h.store.Count(filter)
+	if err != nil {
+		log.Printf("Error counting QR codes: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list QR codes")
+		return
+	}
+	links, err := h.store.ListLinks(codeIDs(codes))
+	if err != nil {
+		log.Printf("Error listing links: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list QR codes")
+		return
+	}
+	tags, collections, err := h.codeGroups(codeIDs(codes))
+	if err != nil {
+		log.Printf("Error listing tags and collections: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list QR codes")
+		return
+	}
+
+	resp := struct {
+		Codes  []apiCode `json:"codes"`
+		Total  int       `json:"total"`
+		Limit  int       `json:"limit"`
+		Offset int       `json:"offset"`
+	}{
+		Codes:  make([]apiCode, 0, len(codes)),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	for _, code := range codes {
+		c := toAPICode(code, links[code.ID])
+		c.Tags, c.Collections = tags[code.ID], collections[code.ID]
+		resp.Codes = append(resp.Codes, c)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleAPIGet(w http.ResponseWriter, r *http.Request) {
+	code, ok := h.apiLoadCode(w, r)
+	if !ok {
+		return
+	}
+	h.writeAPICode(w, http.StatusOK, code)
+}
+
+func (h *Handler) handleAPIUpdate(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.apiLoadCode(w, r)
+	if !ok {
+		return
+	}
+
+	var update codeUpdate
+	if err := decodeJSON(w, r, &update); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	link, err := h.store.GetLinkByCode(existing.ID)
+	if err != nil {
+		log.Printf("Error getting link: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update QR code")
+		return
+	}
+	if update.Target != nil {
+		if link == nil {
+			writeJSONError(w, http.StatusBadRequest, "only dynamic codes have a target")
+			return
+		}
+		if err := checkTarget(*update.Target); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var limits storage.LinkLimits
+	if update.changesLimits() {
+		if link == nil {
+			writeJSONError(w, http.StatusBadRequest, "expiry, scan limits and fallbacks need a dynamic code")
+			return
+		}
+		if limits, err = update.applyLimits(link); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var hash string
+	if update.Passphrase != nil {
+		if link == nil {
+			writeJSONError(w, http.StatusBadRequest, "passphrases need a dynamic code")
+			return
+		}
+		if *update.Passphrase != "" {
+			if hash, err = hashPassphrase(*update.Passphrase); err != nil {
+				status, message := errorStatus(err, "Failed to update QR code")
+				writeJSONError(w, status, message)
+				return
+			}
+		}
+	}
+	var rules string
+	if update.Rules != nil {
+		if link == nil {
+			writeJSONError(w, http.StatusBadRequest, "rules need a dynamic code")
+			return
+		}
+		checked, err := checkRules(*update.Rules)
+		if err == nil {
+			rules, err = encodeRules(checked)
+		}
+		if err != nil {
+			status, message := errorStatus(err, "Failed to update QR code")
+			writeJSONError(w, status, message)
+			return
+		}
+	}
+	var tags []string
+	if update.Tags != nil {
+		if tags, err = checkTags(*update.Tags); err != nil {
+			status, message := errorStatus(err, "Failed to update QR code")
+			writeJSONError(w, status, message)
+			return
+		}
+	}
+	// A dynamic code encodes its short link; what it leads to is its target.
+	if link != nil && update.changesContent() {
+		writeJSONError(w, http.StatusBadRequest, "dynamic codes encode their short link; change the target instead")
+		return
+	}
+
+	req := requestFromCode(existing)
+	update.apply(req)
+	// Turning a stored code into one that carries secrets would store them
+	// without the opt-in that creating such a code requires.
+	if req.sensitive() && !secretCode(existing) {
+		writeJSONError(w, http.StatusBadRequest, "codes carrying secrets are only stored when created with persist")
+		return
+	}
+	code, err := req.code()
+	if err != nil {
+		status, message := errorStatus(err, "Failed to update QR code")
+		writeJSONError(w, status, message)
+		return
+	}
+	code.ID = existing.ID
+
+	if err := h.renderCode(code); err != nil {
+		status, message := errorStatus(err, "Failed to update QR code")
+		writeJSONError(w, status, message)
+		return
+	}
+	// The code, its link and its tags change together or not at all.
+	changes := storage.CodeChanges{Target: update.Target}
+	if update.changesLimits() {
+		changes.Limits = &limits
+	}
+	if update.Passphrase != nil {
+		changes.PassphraseHash = &hash
+	}
+	if update.Rules != nil {
+		changes.Rules = &rules
+	}
+	if update.Tags != nil {
+		changes.Tags = &tags
+	}
+	if err := h.store.UpdateCode(code, changes); err != nil {
+		status, message := errorStatus(err, "Failed to update QR code")
+		writeJSONError(w, status, message)
+		return
+	}
+
+	updated, err := h.store.GetByID(code.ID)
+	if err != nil || updated == nil {
+		log.Printf("Error reloading QR code: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update QR code")
+		return
+	}
+	h.writeAPICode(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := h.store.Delete(id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "QR code not found")
+			return
+		}
+		log.Printf("Error deleting QR code: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete QR code")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiLoadCode fetches the code named by the {id} path value, writing an error
+// response and returning false if it cannot.
+func (h *Handler) apiLoadCode(w http.ResponseWriter, r *http.Request) (*storage.QRCode, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid ID")
+		return nil, false
+	}
+
+	code, err := h.store.GetByID(id)
+	if err != nil {
+		log.Printf("Error getting QR code: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get QR code")
+		return nil, false
+	}
+	if code == nil {
+		writeJSONError(w, http.StatusNotFound, "QR code not found")
+		return nil, false
+	}
+	return code, true
+}
+
+// writeAPICode sends a stored code with its link, if it has one, its tags
+// and its collections.
+func (h *Handler) writeAPICode(w http.ResponseWriter, status int, code *storage.QRCode) {
+	link, err := h.store.GetLinkByCode(code.ID)
+	if err != nil {
+		log.Printf("Error getting link: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get QR code")
+		return
+	}
+	tags, collections, err := h.codeGroups([]int64{code.ID})
+	if err != nil {
+		log.Printf("Error getting tags and collections: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get QR code")
+		return
+	}
+	c := toAPICode(code, link)
+	c.Tags, c.Collections = tags[code.ID], collections[code.ID]
+	writeJSON(w, status, c)
+}
+
+// codeGroups returns the tags and the collection IDs of codes, keyed by
+// code ID.
+func (h *Handler) codeGroups(ids []int64) (map[int64][]string, map[int64][]int64, error) {
+	tags, err := h.store.ListCodeTags(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	collections, err := h.store.ListCodeCollections(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tags, collections, nil
+}
+
+// codeIDs returns the IDs of codes, in order.
+func codeIDs(codes []*storage.QRCode) []int64 {
+	ids := make([]int64, len(codes))
+	for i, code := range codes {
+		ids[i] = code.ID
+	}
+	return ids
+}
+
+func pagination(r *http.Request) (limit, offset int, err error) {
+	limit = apiDefaultLimit
+	query := r.URL.Query()
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > apiMaxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", apiMaxLimit)
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// decodeJSON reads a single JSON object from the request body into v,
+// rejecting unknown fields and oversized bodies.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("invalid JSON: unexpected data after object")
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeJSONError sends {"error": {"status": ..., "message": ...}}, the error
+// shape used by every API endpoint.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	type apiError struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	}
+	writeJSON(w, status, struct {
+		Error apiError `json:"error"`
+	}{apiError{Status: status, Message: message}})
+}
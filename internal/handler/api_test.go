@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func apiRequest(t *testing.T, h *Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func decodeAPIResponse(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected Content-Type application/json, got %s", ct)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestAPICodesLifecycle(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// Create
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","label":"Home","level":"Q"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created apiCode
+	decodeAPIResponse(t, w, &created)
+	if created.ID == 0 || created.Content != "https://example.com" || created.Label != "Home" || created.ECLevel != "Q" {
+		t.Errorf("Unexpected created code %+v", created)
+	}
+	if w.Header().Get("Location") != "/api/v1/codes/1" {
+		t.Errorf("Expected Location /api/v1/codes/1, got %s", w.Header().Get("Location"))
+	}
+	if strings.Contains(w.Body.String(), "image_data") {
+		t.Error("Expected response without image blob")
+	}
+
+	// Get
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var fetched apiCode
+	decodeAPIResponse(t, w, &fetched)
+	if fetched.ImageURL != "/qr/1" {
+		t.Errorf("Expected image URL /qr/1, got %s", fetched.ImageURL)
+	}
+
+	// Update re-renders when content changes and keeps untouched fields
+	before, err := h.store.GetByID(1)
+	if err != nil {
+		t.Fatalf("Failed to get QR code: %v", err)
+	}
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/1", `{"content":"https://example.org"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated apiCode
+	decodeAPIResponse(t, w, &updated)
+	if updated.Content != "https://example.org" || updated.Label != "Home" || updated.ECLevel != "Q" {
+		t.Errorf("Unexpected updated code %+v", updated)
+	}
+	after, err := h.store.GetByID(1)
+	if err != nil {
+		t.Fatalf("Failed to get QR code: %v", err)
+	}
+	if string(after.ImageData) == string(before.ImageData) {
+		t.Error("Expected image to be regenerated")
+	}
+
+	// Delete
+	w = apiRequest(t, h, http.MethodDelete, "/api/v1/codes/1", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes/1", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestAPIListPagination(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.store.Create("content", "", []byte("data")); err != nil {
+			t.Fatalf("Failed to create QR code: %v", err)
+		}
+	}
+
+	w := apiRequest(t, h, http.MethodGet, "/api/v1/codes?limit=2&offset=1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp struct {
+		Codes  []apiCode `json:"codes"`
+		Total  int       `json:"total"`
+		Limit  int       `json:"limit"`
+		Offset int       `json:"offset"`
+	}
+	decodeAPIResponse(t, w, &resp)
+	if len(resp.Codes) != 2 || resp.Total != 3 || resp.Limit != 2 || resp.Offset != 1 {
+		t.Errorf("Unexpected page: %d codes, total %d, limit %d, offset %d", len(resp.Codes), resp.Total, resp.Limit, resp.Offset)
+	}
+
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes?limit=1000", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"invalid JSON", http.MethodPost, "/api/v1/codes", `{"content":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/api/v1/codes", `{"content":"x","colour":"red"}`, http.StatusBadRequest},
+		{"empty content", http.MethodPost, "/api/v1/codes", `{"content":"  "}`, http.StatusBadRequest},
+		{"low contrast", http.MethodPost, "/api/v1/codes", `{"content":"x","foreground":"#eeeeee"}`, http.StatusBadRequest},
+		{"invalid ID", http.MethodGet, "/api/v1/codes/abc", "", http.StatusBadRequest},
+		{"missing", http.MethodGet, "/api/v1/codes/999", "", http.StatusNotFound},
+		{"update missing", http.MethodPatch, "/api/v1/codes/999", `{"label":"x"}`, http.StatusNotFound},
+		{"delete missing", http.MethodDelete, "/api/v1/codes/999", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(t, h, tt.method, tt.target, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			var resp struct {
+				Error struct {
+					Status  int    `json:"status"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			decodeAPIResponse(t, w, &resp)
+			if resp.Error.Status != tt.status || resp.Error.Message == "" {
+				t.Errorf("Unexpected error body %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 
+	"github.com/ironicbadger/qr-code-generator/internal/payload"
 	"github.com/ironicbadger/qr-code-generator/internal/qrcode"
 	"github.com/ironicbadger/qr-code-generator/internal/storage"
 )
@@ -16,6 +19,13 @@ type Handler struct {
 	store     *storage.Store
 	generator *qrcode.Generator
 	templates *template.Template
+	cache     *qrcode.Cache
+	baseURL   string
+	ipHashKey []byte
+	// trustedProxies may set X-Forwarded-For and X-Forwarded-Proto.
+	trustedProxies []netip.Prefix
+	accessKey      []byte
+	unlocks        *unlockLimiter
 }
 
 func New(store *storage.Store, generator *qrcode.Generator, templates *template.Template) *Handler {
@@ -23,6 +33,9 @@ func New(store *storage.Store, generator *qrcode.Generator, templates *template.
 		store:     store,
 		generator: generator,
 		templates: templates,
+		cache:     qrcode.NewCache(qrcode.DefaultCacheBytes),
+		accessKey: newAccessKey(),
+		unlocks:   newUnlockLimiter(),
 	}
 }
 
@@ -30,23 +43,125 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /", h.handleIndex)
 	mux.HandleFunc("POST /generate", h.handleGenerate)
 	mux.HandleFunc("GET /qr/{id}", h.handleGetQR)
+	mux.HandleFunc("GET /render", h.handleRender)
 	mux.HandleFunc("PUT /qr/{id}", h.handleUpdateLabel)
 	mux.HandleFunc("DELETE /qr/{id}", h.handleDelete)
+	mux.HandleFunc("POST /logos", h.handleUploadLogo)
+	mux.HandleFunc("GET /logos/{id}", h.handleGetLogo)
+	mux.HandleFunc("GET /qr/{id}/scans.csv", h.handleScansCSV)
+	mux.HandleFunc("GET /r/{slug}", h.handleRedirect)
+	mux.HandleFunc("POST /r/{slug}", h.handleUnlock)
 	mux.HandleFunc("GET /health", h.handleHealth)
+	h.registerAPIRoutes(mux)
 }
 
 func (h *Handler) handleIndex(w http.ResponseWriter, r *http.Request) {
-	codes, err := h.store.List(100, 0)
+	filter, err := listFilter(r, "type")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.store.List(filter, 100, 0)
 	if err != nil {
 		log.Printf("Error listing QR codes: %v", err)
 		http.Error(w, "Failed to load QR codes", http.StatusInternalServerError)
 		return
 	}
+	links, err := h.store.ListLinks(codeIDs(codes))
+	if err != nil {
+		log.Printf("Error listing links: %v", err)
+		http.Error(w, "Failed to load QR codes", http.StatusInternalServerError)
+		return
+	}
+
+	logos, err := h.store.ListLogos()
+	if err != nil {
+		log.Printf("Error listing logos: %v", err)
+		http.Error(w, "Failed to load logos", http.StatusInternalServerError)
+		return
+	}
+	campaigns, err := h.store.Campaigns()
+	if err != nil {
+		log.Printf("Error listing campaigns: %v", err)
+		http.Error(w, "Failed to load QR codes", http.StatusInternalServerError)
+		return
+	}
+	presets, err := h.store.ListUTMPresets()
+	if err != nil {
+		log.Printf("Error listing UTM presets: %v", err)
+		http.Error(w, "Failed to load UTM presets", http.StatusInternalServerError)
+		return
+	}
+	tags, err := h.store.Tags()
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		http.Error(w, "Failed to load QR codes", http.StatusInternalServerError)
+		return
+	}
+	collections, err := h.store.ListCollections()
+	if err != nil {
+		log.Printf("Error listing collections: %v", err)
+		http.Error(w, "Failed to load QR codes", http.StatusInternalServerError)
+		return
+	}
+	codeTags, codeCollections, err := h.codeGroups(codeIDs(codes))
+	if err != nil {
+		log.Printf("Error listing tags and collections: %v", err)
+		http.Error(w, "Failed to load QR codes", http.StatusInternalServerError)
+		return
+	}
+
+	views := codeViews(codes, links)
+	byID := make(map[int64]*storage.Collection, len(collections))
+	for _, c := range collections {
+		byID[c.ID] = c
+	}
+	for i := range views {
+		views[i].Tags = codeTags[views[i].ID]
+		for _, id := range codeCollections[views[i].ID] {
+			views[i].Collections = append(views[i].Collections, byID[id])
+		}
+	}
 
 	data := struct {
-		QRCodes []*storage.QRCode
+		QRCodes            []codeView
+		Kinds              []payload.Kind
+		Filter             string
+		PlainText          string
+		Campaign           string
+		Campaigns          []storage.CampaignCount
+		Presets            []*storage.UTMPreset
+		Tag                string
+		Tags               []storage.TagCount
+		Collection         int64
+		Collections        []*storage.Collection
+		Logos              []*storage.Logo
+		DefaultLogoPercent int
+		MinLogoPercent     int
+		MaxLogoPercent     int
+		DefaultSize        int
+		MinSize            int
+		MaxSize            int
 	}{
-		QRCodes: codes,
+		QRCodes:            views,
+		Kinds:              payload.Kinds(),
+		Filter:             filter.PayloadType,
+		PlainText:          storage.PlainText,
+		Campaign:           filter.Campaign,
+		Campaigns:          campaigns,
+		Presets:            presets,
+		Tag:                filter.Tag,
+		Tags:               tags,
+		Collection:         filter.CollectionID,
+		Collections:        collections,
+		Logos:              logos,
+		DefaultLogoPercent: qrcode.DefaultLogoPercent,
+		MinLogoPercent:     qrcode.MinLogoPercent,
+		MaxLogoPercent:     qrcode.MaxLogoPercent,
+		DefaultSize:        storage.DefaultSize,
+		MinSize:            minRenderSize,
+		MaxSize:            maxRenderSize,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -62,23 +177,27 @@ func (h *Handler) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content := strings.TrimSpace(r.FormValue("content"))
-	if content == "" {
-		http.Error(w, "Content is required", http.StatusBadRequest)
+	req, err := formRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	imageData, err := h.generator.Generate(content)
-	if err != nil {
-		log.Printf("Error generating QR code: %v", err)
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+	// Codes carrying secrets are shown once instead of being saved.
+	if req.ephemeral() {
+		image, err := h.renderEphemeral(req)
+		if err != nil {
+			status, message := errorStatus(err, "Failed to generate QR code")
+			http.Error(w, message, status)
+			return
+		}
+		writeEphemeral(w, image)
 		return
 	}
 
-	_, err = h.store.Create(content, "", imageData)
-	if err != nil {
-		log.Printf("Error saving QR code: %v", err)
-		http.Error(w, "Failed to save QR code", http.StatusInternalServerError)
+	if _, _, err := h.createCode(r, req); err != nil {
+		status, message := errorStatus(err, "Failed to generate QR code")
+		http.Error(w, message, status)
 		return
 	}
 
@@ -93,6 +212,22 @@ func (h *Handler) handleGetQR(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The stored PNG answers plain requests; anything else is rendered from
+	// the saved settings.
+	query := r.URL.Query()
+	if strings.EqualFold(query.Get("format"), "pdf") {
+		h.serveRendered(w, r, id, "pdf")
+		return
+	}
+	if wantsSVG(r) {
+		h.serveRendered(w, r, id, "svg")
+		return
+	}
+	if query.Get("size") != "" || query.Get("size_mm") != "" || query.Get("margin") != "" {
+		h.serveRendered(w, r, id, "png")
+		return
+	}
+
 	qr, err := h.store.GetByID(id)
 	if err != nil {
 		log.Printf("Error getting QR code: %v", err)
@@ -103,10 +238,92 @@ func (h *Handler) handleGetQR(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "QR code not found", http.StatusNotFound)
 		return
 	}
+	image, err := h.store.GetImage(id)
+	if err != nil {
+		log.Printf("Error getting QR code: %v", err)
+		http.Error(w, "Failed to get QR code", http.StatusInternalServerError)
+		return
+	}
+	if image == nil {
+		http.Error(w, "QR code not found", http.StatusNotFound)
+		return
+	}
 
+	// Saved secrets are kept out of any HTTP cache, as in serveRendered.
+	if secretCode(qr) {
+		w.Header().Set("Cache-Control", "no-store")
+	}
 	w.Header().Set("Content-Type", "image/png")
 	w.Header().Set("Content-Disposition", "inline; filename=\"qr-"+idStr+".png\"")
-	if _, err := w.Write(qr.ImageData); err != nil {
+	w.Header().Set("Vary", "Accept")
+	if _, err := w.Write(image); err != nil {
+		log.Printf("Error writing QR image: %v", err)
+	}
+}
+
+// serveRendered regenerates a stored code from its saved settings, applying
+// any size, module or margin overrides from the query. Renders are cached by
+// a hash of their inputs, which doubles as the ETag: editing the code changes
+// the hash, so clients may revalidate but never see a stale image.
+func (h *Handler) serveRendered(w http.ResponseWriter, r *http.Request, id int64, format string) {
+	qr, err := h.store.GetByID(id)
+	if err != nil {
+		log.Printf("Error getting QR code: %v", err)
+		http.Error(w, "Failed to get QR code", http.StatusInternalServerError)
+		return
+	}
+	if qr == nil {
+		http.Error(w, "QR code not found", http.StatusNotFound)
+		return
+	}
+
+	opts, err := h.renderOptions(qr)
+	if err != nil {
+		log.Printf("Error loading render options: %v", err)
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+	// PDF, like SVG, is vector output sized by module.
+	if format == "png" {
+		err = pngOptions(r, &opts)
+	} else {
+		err = svgOptions(r, &opts)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var image []byte
+	if secretCode(qr) {
+		// Saved secrets are still kept out of the render cache and any HTTP
+		// cache.
+		w.Header().Set("Cache-Control", "no-store")
+		image, err = render(h.generator, format, qr.Content, opts)
+	} else {
+		etag := renderKey(format, qr.Content, opts, qr.LogoID)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Vary", "Accept")
+		if matchesETag(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		image, err = h.renderCached(h.generator, etag, format, qr.Content, opts)
+	}
+	if errors.Is(err, qrcode.ErrVerificationFailed) {
+		http.Error(w, "Rendered QR code does not scan at this size", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Error generating QR code: %v", err)
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", "inline; filename=\"qr-"+strconv.FormatInt(id, 10)+"."+format+"\"")
+	if _, err := w.Write(image); err != nil {
 		log.Printf("Error writing QR image: %v", err)
 	}
 }
@@ -128,7 +345,7 @@ func (h *Handler) handleUpdateLabel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.store.UpdateLabel(id, req.Label); err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, storage.ErrNotFound) {
 			http.Error(w, "QR code not found", http.StatusNotFound)
 			return
 		}
@@ -152,7 +369,7 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.store.Delete(id); err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, storage.ErrNotFound) {
 			http.Error(w, "QR code not found", http.StatusNotFound)
 			return
 		}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"html/template"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -42,6 +45,8 @@ func setupTestHandler(t *testing.T) (*Handler, func()) {
 			{{range .QRCodes}}<div>{{.ID}}: {{.Content}}</div>{{end}}
 		</body>
 		</html>
+		{{define "inactive.html"}}{{.Message}}{{end}}
+		{{define "unlock.html"}}<form action="/r/{{.Slug}}">{{.Error}}</form>{{end}}
 	`))
 
 	h := New(store, generator, tmpl)
@@ -243,3 +248,572 @@ func TestHandleDelete(t *testing.T) {
 		t.Error("Expected QR code to be deleted")
 	}
 }
+
+func TestHandleGetQRSVG(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	qr, err := h.store.Create("test", "", []byte{0x89, 0x50, 0x4E, 0x47})
+	if err != nil {
+		t.Fatalf("Failed to create QR code: %v", err)
+	}
+	id := strconv.FormatInt(qr.ID, 10)
+
+	// Query parameter
+	req := httptest.NewRequest(http.MethodGet, "/qr/"+id+"?format=svg", nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	h.handleGetQR(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("Expected Content-Type image/svg+xml, got %s", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "<svg") {
+		t.Error("Expected SVG body")
+	}
+
+	// Accept header
+	req = httptest.NewRequest(http.MethodGet, "/qr/"+id, nil)
+	req.SetPathValue("id", id)
+	req.Header.Set("Accept", "image/svg+xml,image/*;q=0.8")
+	w = httptest.NewRecorder()
+	h.handleGetQR(w, req)
+
+	if w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("Expected Content-Type image/svg+xml, got %s", w.Header().Get("Content-Type"))
+	}
+
+	// Invalid margin
+	req = httptest.NewRequest(http.MethodGet, "/qr/"+id+"?format=svg&margin=-1", nil)
+	req.SetPathValue("id", id)
+	w = httptest.NewRecorder()
+	h.handleGetQR(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleGenerateLevel(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{}
+	form.Set("content", "https://example.com")
+	form.Set("level", "H")
+
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 (redirect), got %d", w.Code)
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 1, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected one stored code, got %v (%v)", codes, err)
+	}
+	if codes[0].ECLevel != "H" {
+		t.Errorf("Expected level 'H', got '%s'", codes[0].ECLevel)
+	}
+
+	form.Set("level", "Z")
+	req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleGenerateColors(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{}
+	form.Set("content", "https://example.com")
+	form.Set("foreground", "#003366")
+	form.Set("transparent", "on")
+
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 (redirect), got %d: %s", w.Code, w.Body.String())
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 1, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected one stored code, got %v (%v)", codes, err)
+	}
+	if codes[0].Foreground != "#003366" || codes[0].Background != "transparent" {
+		t.Errorf("Unexpected stored colours %s on %s", codes[0].Foreground, codes[0].Background)
+	}
+
+	// Low contrast
+	form = url.Values{}
+	form.Set("content", "https://example.com")
+	form.Set("foreground", "#eeeeee")
+	form.Set("background", "#ffffff")
+
+	req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleLogoUploadAndGenerate(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var logoPNG bytes.Buffer
+	if err := png.Encode(&logoPNG, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatalf("Failed to encode logo: %v", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("logo", "acme.png")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	if _, err := part.Write(logoPNG.Bytes()); err != nil {
+		t.Fatalf("Failed to write form file: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	h.handleUploadLogo(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 (redirect), got %d: %s", w.Code, w.Body.String())
+	}
+
+	logos, err := h.store.ListLogos()
+	if err != nil || len(logos) != 1 {
+		t.Fatalf("Expected one stored logo, got %v (%v)", logos, err)
+	}
+	if logos[0].Name != "acme" {
+		t.Errorf("Expected logo name from filename, got %q", logos[0].Name)
+	}
+
+	form := url.Values{}
+	form.Set("content", "https://example.com")
+	form.Set("level", "L")
+	form.Set("logo_id", strconv.FormatInt(logos[0].ID, 10))
+
+	req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 (redirect), got %d: %s", w.Code, w.Body.String())
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 1, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected one stored code, got %v (%v)", codes, err)
+	}
+	if codes[0].ECLevel != "H" || codes[0].LogoID != logos[0].ID {
+		t.Errorf("Expected level H with logo, got level %s logo %d", codes[0].ECLevel, codes[0].LogoID)
+	}
+
+	// Unknown logo
+	form.Set("logo_id", "99999")
+	req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleLogoUploadRejectsNonImage(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("logo", "logo.svg")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	if _, err := part.Write([]byte("<svg></svg>")); err != nil {
+		t.Fatalf("Failed to write form file: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	h.handleUploadLogo(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleGenerateVerified(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+	h.generator.SetVerify(true)
+
+	form := url.Values{}
+	form.Set("content", "https://example.com")
+
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 (redirect), got %d: %s", w.Code, w.Body.String())
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 1, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected one stored code, got %v (%v)", codes, err)
+	}
+	if codes[0].Verification != storage.VerificationVerified {
+		t.Errorf("Expected verification '%s', got '%s'", storage.VerificationVerified, codes[0].Verification)
+	}
+
+	image, err := h.store.GetImage(codes[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get image: %v", err)
+	}
+	decoded, err := qrcode.Decode(image)
+	if err != nil || decoded != "https://example.com" {
+		t.Errorf("Expected stored image to decode to content, got %q (%v)", decoded, err)
+	}
+}
+
+func TestHandleRender(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/render?data=https%3A%2F%2Fexample.com&size=128", nil)
+	w := httptest.NewRecorder()
+
+	h.handleRender(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected Content-Type image/png, got %s", w.Header().Get("Content-Type"))
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || !strings.Contains(w.Header().Get("Cache-Control"), "max-age") {
+		t.Errorf("Expected caching headers, got ETag %q Cache-Control %q", etag, w.Header().Get("Cache-Control"))
+	}
+
+	// Nothing is persisted
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 0 {
+		t.Errorf("Expected no stored codes, got %d", len(codes))
+	}
+
+	// Conditional request
+	req = httptest.NewRequest(http.MethodGet, "/render?size=128&data=https%3A%2F%2Fexample.com", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+
+	h.handleRender(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", w.Code)
+	}
+
+	// Different parameters produce a different tag
+	req = httptest.NewRequest(http.MethodGet, "/render?data=https%3A%2F%2Fexample.com&size=128&format=svg", nil)
+	w = httptest.NewRecorder()
+
+	h.handleRender(w, req)
+
+	if w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("Expected Content-Type image/svg+xml, got %s", w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("Expected different ETag for SVG output")
+	}
+}
+
+func TestHandleGetQRResize(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// A row saved before render settings were stored
+	qr, err := h.store.Create("https://example.com", "legacy", []byte("old png"))
+	if err != nil {
+		t.Fatalf("Failed to create QR code: %v", err)
+	}
+	path := "/qr/" + strconv.FormatInt(qr.ID, 10)
+
+	req := httptest.NewRequest(http.MethodGet, path+"?size=1024", nil)
+	req.SetPathValue("id", strconv.FormatInt(qr.ID, 10))
+	w := httptest.NewRecorder()
+
+	h.handleGetQR(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 1024 || b.Dy() != 1024 {
+		t.Errorf("Expected 1024x1024 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag on regenerated image")
+	}
+
+	// Revalidation
+	req = httptest.NewRequest(http.MethodGet, path+"?size=1024", nil)
+	req.SetPathValue("id", strconv.FormatInt(qr.ID, 10))
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+
+	h.handleGetQR(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", w.Code)
+	}
+
+	// Without parameters the stored image is served untouched
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	req.SetPathValue("id", strconv.FormatInt(qr.ID, 10))
+	w = httptest.NewRecorder()
+
+	h.handleGetQR(w, req)
+
+	if w.Body.String() != "old png" {
+		t.Errorf("Expected stored image, got %d bytes", w.Body.Len())
+	}
+
+	for _, size := range []string{"10", "4096", "big"} {
+		req = httptest.NewRequest(http.MethodGet, path+"?size="+size, nil)
+		req.SetPathValue("id", strconv.FormatInt(qr.ID, 10))
+		w = httptest.NewRecorder()
+
+		h.handleGetQR(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("size=%s: expected status 400, got %d", size, w.Code)
+		}
+	}
+}
+
+func TestHandleGenerateRenderSpec(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{"content": {"https://example.com"}, "style": {"dots"}, "margin": {"2"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 1 {
+		t.Fatalf("Expected 1 QR code, got %d", len(codes))
+	}
+	if codes[0].Style != "dots" || codes[0].Margin != 2 || codes[0].Size != storage.DefaultSize {
+		t.Errorf("Expected dots, margin 2, default size; got %q, %d, %d", codes[0].Style, codes[0].Margin, codes[0].Size)
+	}
+
+	for _, form := range []url.Values{
+		{"content": {"x"}, "style": {"hearts"}},
+		{"content": {"x"}, "margin": {"50"}},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		h.handleGenerate(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", form, w.Code)
+		}
+	}
+}
+
+func TestHandleGenerateSize(t *testing.T) {
+	tests := []struct {
+		form url.Values
+		want int
+	}{
+		{url.Values{"size": {"512"}}, 512},
+		{url.Values{"size": {"256"}, "size_mm": {"50"}, "dpi": {"300"}}, 591},
+		{url.Values{"size_mm": {"30"}}, 354},
+	}
+
+	for _, tt := range tests {
+		h, cleanup := setupTestHandler(t)
+
+		tt.form.Set("content", "https://example.com")
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		h.handleGenerate(w, req)
+
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("%v: expected status 303, got %d: %s", tt.form, w.Code, w.Body.String())
+		}
+		codes, err := h.store.List(storage.Filter{}, 10, 0)
+		if err != nil {
+			t.Fatalf("Failed to list QR codes: %v", err)
+		}
+		if codes[0].Size != tt.want {
+			t.Errorf("%v: expected size %d, got %d", tt.form, tt.want, codes[0].Size)
+		}
+		data, err := h.store.GetImage(codes[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get image: %v", err)
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode PNG: %v", err)
+		}
+		if cfg.Width != tt.want {
+			t.Errorf("%v: expected %d px image, got %d", tt.form, tt.want, cfg.Width)
+		}
+		cleanup()
+	}
+}
+
+func TestHandleGenerateSizeLimits(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for _, form := range []url.Values{
+		{"size": {"32"}},
+		{"size": {"4096"}},
+		{"size_mm": {"500"}},
+		{"size_mm": {"50"}, "dpi": {"10"}},
+		{"size_mm": {"wide"}},
+	} {
+		form.Set("content", "https://example.com")
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		h.handleGenerate(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", form, w.Code)
+		}
+	}
+}
+
+func TestHandleGetQRPrintSize(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	qr, err := h.store.Create("https://example.com", "", []byte("old png"))
+	if err != nil {
+		t.Fatalf("Failed to create QR code: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/qr/1?size_mm=40&dpi=600", nil)
+	req.SetPathValue("id", strconv.FormatInt(qr.ID, 10))
+	w := httptest.NewRecorder()
+
+	h.handleGetQR(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	cfg, err := png.DecodeConfig(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if cfg.Width != 945 {
+		t.Errorf("Expected 945 px for 40 mm at 600 DPI, got %d", cfg.Width)
+	}
+}
+
+func TestHandleRenderUnverified(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+	h.generator.SetVerify(true)
+
+	req := httptest.NewRequest(http.MethodGet, "/render?data=test", nil)
+	w := httptest.NewRecorder()
+	h.handleRender(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !h.generator.Verifies() {
+		t.Error("Expected stored codes to still be verified")
+	}
+}
+
+func TestHandleRenderLimits(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for _, query := range []string{
+		"",
+		"data=" + strings.Repeat("a", maxRenderDataBytes+1),
+		"data=test&size=10",
+		"data=test&size=100000",
+		"data=test&format=gif",
+		"data=test&level=X",
+		"data=test&fg=%23eeeeee",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/render?"+query, nil)
+		w := httptest.NewRecorder()
+
+		h.handleRender(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %.40q, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+// Dynamic code limits. Generated slugs of slugLength base62 characters
+// leave 62^7, about 3.5 trillion, to pick from.
+const (
+	maxTargetBytes  = 2048
+	slugLength      = 7
+	maxSlugAttempts = 5
+)
+
+// slugAlphabet is the base62 alphabet generated slugs are drawn from.
+const slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// vanitySlug matches the slugs users may choose: 3 to 64 letters, digits,
+// hyphens and underscores, starting and ending with a letter or digit.
+var vanitySlug = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{1,62}[A-Za-z0-9]$`)
+
+// reservedSlugs are the top-level paths of this server, kept free in case
+// short links move to the root.
+var reservedSlugs = []string{"api", "generate", "health", "logos", "qr", "r", "render"}
+
+// checkSlug validates a slug chosen by the user.
+func checkSlug(slug string) error {
+	if !vanitySlug.MatchString(slug) {
+		return badRequest("slug must be 3 to 64 letters, digits, hyphens or underscores, starting and ending with a letter or digit")
+	}
+	for _, reserved := range reservedSlugs {
+		if strings.EqualFold(slug, reserved) {
+			return badRequest("slug %q is reserved", slug)
+		}
+	}
+	return nil
+}
+
+// SetBaseURL sets the scheme and host that short links of dynamic codes are
+// built on, such as https://qr.example.com. Without it the host of the
+// request that creates a code is used.
+func (h *Handler) SetBaseURL(base string) error {
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", base)
+	}
+	h.baseURL = strings.TrimSuffix(u.String(), "/")
+	return nil
+}
+
+// shortURL returns the URL a dynamic code with slug encodes.
+func (h *Handler) shortURL(r *http.Request, slug string) string {
+	base := h.baseURL
+	if base == "" {
+		base = h.requestScheme(r) + "://" + r.Host
+	}
+	return base + "/r/" + slug
+}
+
+// newSlug returns a random slug. Collisions are unlikely but possible, and
+// are caught by the unique index on links.
+func newSlug() string {
+	// Bytes at or above the largest multiple of the alphabet size are
+	// skipped so every character is equally likely.
+	limit := 256 - 256%len(slugAlphabet)
+	slug := make([]byte, 0, slugLength)
+	buf := make([]byte, slugLength)
+	for len(slug) < slugLength {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("crypto/rand failed: %v", err))
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(slug) < slugLength {
+				slug = append(slug, slugAlphabet[int(b)%len(slugAlphabet)])
+			}
+		}
+	}
+	return string(slug)
+}
+
+// checkTarget validates a redirect target.
+func checkTarget(target string) error {
+	return checkRedirectURL("target", target)
+}
+
+// checkRedirectURL validates a URL that scans are redirected to; name says
+// which one in errors.
+func checkRedirectURL(name, target string) error {
+	if target == "" {
+		return badRequest("%s URL is required", name)
+	}
+	if len(target) > maxTargetBytes {
+		return badRequest("%s URL must be at most %d bytes", name, maxTargetBytes)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return badRequest("%s must be an http or https URL", name)
+	}
+	return nil
+}
+
+// linkLimits are the user-supplied limits of a dynamic code, with times in
+// RFC 3339. Empty fields leave the link unlimited.
+type linkLimits struct {
+	StartsAt  string `json:"starts_at"`
+	ExpiresAt string `json:"expires_at"`
+	MaxScans  int    `json:"max_scans"`
+	Fallback  string `json:"fallback"`
+}
+
+func (l *linkLimits) isZero() bool {
+	return *l == linkLimits{}
+}
+
+// formatLimits is the inverse of parse, used to apply partial updates.
+func formatLimits(limits storage.LinkLimits) linkLimits {
+	l := linkLimits{MaxScans: limits.MaxScans, Fallback: limits.Fallback}
+	if limits.StartsAt != nil {
+		l.StartsAt = limits.StartsAt.Format(time.RFC3339)
+	}
+	if limits.ExpiresAt != nil {
+		l.ExpiresAt = limits.ExpiresAt.Format(time.RFC3339)
+	}
+	return l
+}
+
+// parse validates the limits.
+func (l *linkLimits) parse() (storage.LinkLimits, error) {
+	var limits storage.LinkLimits
+	for _, bound := range []struct {
+		name, value string
+		t           **time.Time
+	}{
+		{"starts_at", l.StartsAt, &limits.StartsAt},
+		{"expires_at", l.ExpiresAt, &limits.ExpiresAt},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return limits, badRequest("%s must be an RFC 3339 time such as 2026-06-01T09:00:00Z", bound.name)
+		}
+		// Limits are stored to the second.
+		t = t.UTC().Truncate(time.Second)
+		*bound.t = &t
+	}
+	if limits.StartsAt != nil && limits.ExpiresAt != nil && !limits.ExpiresAt.After(*limits.StartsAt) {
+		return limits, badRequest("expires_at must be after starts_at")
+	}
+
+	if l.MaxScans < 0 {
+		return limits, badRequest("max_scans must not be negative")
+	}
+	limits.MaxScans = l.MaxScans
+
+	if fallback := strings.TrimSpace(l.Fallback); fallback != "" {
+		if err := checkRedirectURL("fallback", fallback); err != nil {
+			return limits, err
+		}
+		limits.Fallback = fallback
+	}
+	return limits, nil
+}
+
+// createDynamic saves a code that encodes a short link to this server, which
+// redirects to the URL given as the request content. The link uses the
+// requested slug, or a generated one if none was given. The request's tags
+// must have been checked.
+func (h *Handler) createDynamic(r *http.Request, req *codeRequest) (*storage.QRCode, *storage.Link, error) {
+	if req.PayloadType != "" {
+		return nil, nil, badRequest("dynamic codes redirect to a URL and cannot carry a payload")
+	}
+	target := strings.TrimSpace(req.Content)
+	if err := checkTarget(target); err != nil {
+		return nil, nil, err
+	}
+	limits, err := req.linkLimits.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	var hash string
+	if req.Passphrase != "" {
+		if hash, err = hashPassphrase(req.Passphrase); err != nil {
+			return nil, nil, err
+		}
+	}
+	rules, err := checkRules(req.Rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := encodeRules(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vanity := strings.TrimSpace(req.Slug)
+	if vanity != "" {
+		if err := checkSlug(vanity); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		slug := vanity
+		if slug == "" {
+			slug = newSlug()
+		}
+		link := &storage.Link{Slug: slug, Target: target, LinkLimits: limits, PassphraseHash: hash, Rules: encoded}
+		short := *req
+		short.Content = h.shortURL(r, link.Slug)
+		code, err := short.code()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := h.renderCode(code); err != nil {
+			return nil, nil, err
+		}
+
+		saved, err := h.store.InsertDynamic(code, link, req.Tags...)
+		if errors.Is(err, storage.ErrSlugTaken) {
+			if vanity != "" {
+				return nil, nil, &requestError{
+					status:  http.StatusConflict,
+					message: fmt.Sprintf("slug %q is already taken; choose another or leave it empty for a generated one", vanity),
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return saved, link, nil
+	}
+	return nil, nil, errors.New("failed to find a free slug")
+}
+
+// handleRedirect sends a scan of a dynamic code on to its current target and
+// records it. Redirects are not cacheable, so a changed target takes effect
+// at once and every scan reaches the server. Scans outside the link's limits
+// go to its fallback instead, and scans of a protected link are first asked
+// for its passphrase.
+func (h *Handler) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	link, err := h.store.GetLink(r.PathValue("slug"))
+	if err != nil {
+		log.Printf("Error getting link: %v", err)
+		http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
+		return
+	}
+	if link == nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	now := time.Now()
+	if link.PassphraseHash != "" && link.Status(now) == storage.LinkActive && !h.hasAccess(r, link, now) {
+		h.serveUnlock(w, link, "", http.StatusOK)
+		return
+	}
+	h.followLink(w, r, link, http.StatusFound)
+}
+
+// followLink redirects to the target of link, or the one its rules pick,
+// with the given status code if its limits allow. Unless it is a HEAD
+// request, which comes from link checkers rather than scans, the scan counts
+// against the limits and the deciding rule's hits, and it is recorded if it
+// is redirected to the target or the fallback.
+func (h *Handler) followLink(w http.ResponseWriter, r *http.Request, link *storage.Link, code int) {
+	now := time.Now()
+	status := link.Status(now)
+	if status == storage.LinkActive && r.Method != http.MethodHead {
+		var err error
+		if status, err = h.store.ClaimScan(link.CodeID, now); err != nil {
+			log.Printf("Error claiming scan: %v", err)
+			http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	scanned := r.Method != http.MethodHead
+	if status != storage.LinkActive {
+		if scanned && link.Fallback != "" {
+			h.recordScan(r, link)
+		}
+		h.serveInactive(w, r, link, status)
+		return
+	}
+
+	target, hit := chooseTarget(r, link, now)
+	if scanned {
+		h.recordScan(r, link)
+		if link.Rules != "" {
+			if err := h.store.RecordRuleHit(link.CodeID, hit, now); err != nil {
+				log.Printf("Error recording rule hit: %v", err)
+			}
+		}
+	}
+	http.Redirect(w, r, target, code)
+}
+
+// inactiveMessages are shown for scans outside a link's limits when it has no
+// fallback URL.
+var inactiveMessages = map[storage.LinkStatus]string{
+	storage.LinkScheduled: "This code is not active yet.",
+	storage.LinkExpired:   "This code has expired.",
+	storage.LinkExhausted: "This code has reached its scan limit.",
+}
+
+// serveInactive redirects a scan of an inactive link to its fallback, or
+// shows a notice: 404 before the link starts and 410 once it has ended.
+func (h *Handler) serveInactive(w http.ResponseWriter, r *http.Request, link *storage.Link, status storage.LinkStatus) {
+	if link.Fallback != "" {
+		http.Redirect(w, r, link.Fallback, http.StatusFound)
+		return
+	}
+
+	code := http.StatusGone
+	if status == storage.LinkScheduled {
+		code = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	data := struct{ Message string }{inactiveMessages[status]}
+	if err := h.templates.ExecuteTemplate(w, "inactive.html", data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDynamicCodes(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+	if err := h.SetBaseURL("https://qr.example.com/"); err != nil {
+		t.Fatalf("SetBaseURL failed: %v", err)
+	}
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com/menu","dynamic":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created apiCode
+	decodeAPIResponse(t, w, &created)
+	if len(created.Slug) != slugLength || strings.Trim(created.Slug, slugAlphabet) != "" {
+		t.Errorf("Unexpected slug %q", created.Slug)
+	}
+	if want := "https://qr.example.com/r/" + created.Slug; created.Content != want {
+		t.Errorf("Expected content %q, got %q", want, created.Content)
+	}
+	if created.Target != "https://example.com/menu" {
+		t.Errorf("Expected target https://example.com/menu, got %q", created.Target)
+	}
+
+	// Scans are redirected to the target
+	w = apiRequest(t, h, http.MethodGet, "/r/"+created.Slug, "")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/menu" {
+		t.Fatalf("Expected redirect to the target, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected Cache-Control no-store, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	// The target can be changed without changing the code
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(created.ID, 10)
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"target":"https://example.com/dinner"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated apiCode
+	decodeAPIResponse(t, w, &updated)
+	if updated.Target != "https://example.com/dinner" || updated.Content != created.Content {
+		t.Errorf("Unexpected updated code %+v", updated)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/r/"+created.Slug, "")
+	if w.Header().Get("Location") != "https://example.com/dinner" {
+		t.Errorf("Expected redirect to the new target, got %q", w.Header().Get("Location"))
+	}
+
+	// Listing includes the link
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes", "")
+	var list struct {
+		Codes []apiCode `json:"codes"`
+	}
+	decodeAPIResponse(t, w, &list)
+	if len(list.Codes) != 1 || list.Codes[0].Target != "https://example.com/dinner" {
+		t.Errorf("Expected the listed code to carry its target, got %+v", list.Codes)
+	}
+
+	// Deleting the code removes its link
+	w = apiRequest(t, h, http.MethodDelete, codeURL, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/r/"+created.Slug, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", w.Code)
+	}
+}
+
+func TestDynamicCodesValidate(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not a URL", `{"content":"hello","dynamic":true}`},
+		{"unsupported scheme", `{"content":"javascript:alert(1)","dynamic":true}`},
+		{"payload", `{"payload_type":"phone","payload":{"number":"+15550100"},"dynamic":true}`},
+		{"too long", `{"content":"https://example.com/` + strings.Repeat("a", maxTargetBytes) + `","dynamic":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Without a base URL, links use the request's host
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var dynamic apiCode
+	decodeAPIResponse(t, w, &dynamic)
+	if want := "http://example.com/r/" + dynamic.Slug; dynamic.Content != want {
+		t.Errorf("Expected content %q, got %q", want, dynamic.Content)
+	}
+
+	// The content of a dynamic code is its short link
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(dynamic.ID, 10)
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"content":"https://example.org"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a content change, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"target":"ftp://example.org"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid target, got %d", w.Code)
+	}
+
+	// Static codes have no target
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com"}`)
+	var static apiCode
+	decodeAPIResponse(t, w, &static)
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/"+strconv.FormatInt(static.ID, 10), `{"target":"https://example.org"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a static code, got %d", w.Code)
+	}
+
+	w = apiRequest(t, h, http.MethodGet, "/r/missing", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown slug, got %d", w.Code)
+	}
+
+	if err := h.SetBaseURL("qr.example.com"); err == nil {
+		t.Error("Expected an error for a base URL without a scheme")
+	}
+}
+
+func TestVanitySlugs(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+	if err := h.SetBaseURL("https://qr.example.com"); err != nil {
+		t.Fatalf("SetBaseURL failed: %v", err)
+	}
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com/sale","dynamic":true,"slug":"Spring-Sale_26"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+	if code.Slug != "Spring-Sale_26" || code.Content != "https://qr.example.com/r/Spring-Sale_26" {
+		t.Errorf("Expected the vanity slug, got %q %q", code.Slug, code.Content)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/r/Spring-Sale_26", "")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/sale" {
+		t.Errorf("Expected redirect to the target, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// A taken slug is a conflict, not a retry with another slug
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com/other","dynamic":true,"slug":"Spring-Sale_26"}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "already taken") {
+		t.Errorf("Expected 409 for a taken slug, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, slug := range []string{"ab", "-sale", "sale-", "spring sale", "café", "API", "health", strings.Repeat("a", 65)} {
+		w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true,"slug":"`+slug+`"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for slug %q, got %d", slug, w.Code)
+		}
+	}
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","slug":"static"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a slug on a static code, got %d", w.Code)
+	}
+}
+
+func TestDynamicCodeLimits(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	create := func(body string) apiCode {
+		t.Helper()
+		w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var code apiCode
+		decodeAPIResponse(t, w, &code)
+		return code
+	}
+
+	// A scan limit sends later scans to the fallback
+	limited := create(`{"content":"https://example.com/sale","dynamic":true,"max_scans":2,"fallback":"https://example.com/over"}`)
+	if limited.MaxScans != 2 || limited.Status != "active" || limited.Fallback != "https://example.com/over" {
+		t.Errorf("Unexpected limits %+v", limited)
+	}
+	for i, want := range []string{"https://example.com/sale", "https://example.com/sale", "https://example.com/over"} {
+		w := apiRequest(t, h, http.MethodGet, "/r/"+limited.Slug, "")
+		if w.Code != http.StatusFound || w.Header().Get("Location") != want {
+			t.Errorf("Scan %d: expected redirect to %s, got %d %q", i+1, want, w.Code, w.Header().Get("Location"))
+		}
+	}
+	// HEAD requests do not use up scans
+	w := apiRequest(t, h, http.MethodHead, "/r/"+limited.Slug, "")
+	if w.Header().Get("Location") != "https://example.com/over" {
+		t.Errorf("Expected HEAD to see the fallback, got %q", w.Header().Get("Location"))
+	}
+
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(limited.ID, 10)
+	w = apiRequest(t, h, http.MethodGet, codeURL, "")
+	var got apiCode
+	decodeAPIResponse(t, w, &got)
+	if got.Status != "exhausted" || got.ScanCount != 2 {
+		t.Errorf("Expected an exhausted link after 2 scans, got %q after %d", got.Status, got.ScanCount)
+	}
+
+	// Raising the limit reactivates the link
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"max_scans":3,"fallback":""}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var reactivated apiCode
+	decodeAPIResponse(t, w, &reactivated)
+	if reactivated.Status != "active" || reactivated.Fallback != "" {
+		t.Errorf("Expected an active link without fallback, got %+v", reactivated)
+	}
+	apiRequest(t, h, http.MethodGet, "/r/"+limited.Slug, "")
+	w = apiRequest(t, h, http.MethodGet, "/r/"+limited.Slug, "")
+	if w.Code != http.StatusGone || !strings.Contains(w.Body.String(), "scan limit") {
+		t.Errorf("Expected 410 with a notice without fallback, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Validity windows
+	hour := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	scheduled := create(`{"content":"https://example.com","dynamic":true,"starts_at":"` + hour + `"}`)
+	w = apiRequest(t, h, http.MethodGet, "/r/"+scheduled.Slug, "")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "not active yet") {
+		t.Errorf("Expected 404 before the start, got %d %q", w.Code, w.Body.String())
+	}
+	past := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/"+strconv.FormatInt(scheduled.ID, 10), `{"starts_at":"","expires_at":"`+past+`"}`)
+	var expired apiCode
+	decodeAPIResponse(t, w, &expired)
+	if expired.Status != "expired" || expired.StartsAt != nil {
+		t.Errorf("Expected an expired link, got %+v", expired)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/r/"+scheduled.Slug, "")
+	if w.Code != http.StatusGone || !strings.Contains(w.Body.String(), "expired") {
+		t.Errorf("Expected 410 after expiry, got %d %q", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"content":"https://example.com","dynamic":true,"starts_at":"tomorrow"}`,
+		`{"content":"https://example.com","dynamic":true,"starts_at":"2026-06-02T00:00:00Z","expires_at":"2026-06-01T00:00:00Z"}`,
+		`{"content":"https://example.com","dynamic":true,"max_scans":-1}`,
+		`{"content":"https://example.com","dynamic":true,"fallback":"mailto:a@example.com"}`,
+		`{"content":"https://example.com","max_scans":5}`,
+	} {
+		w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ironicbadger/qr-code-generator/internal/qrcode"
+)
+
+func (h *Handler) handleUploadLogo(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, qrcode.MaxLogoBytes+64<<10)
+	if err := r.ParseMultipartForm(qrcode.MaxLogoBytes); err != nil {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("logo")
+	if err != nil {
+		http.Error(w, "Logo file is required", http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("Error closing upload: %v", err)
+		}
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(file, qrcode.MaxLogoBytes+1))
+	if err != nil {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+
+	_, format, err := qrcode.DecodeLogo(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+
+	if _, err := h.store.CreateLogo(name, "image/"+format, data); err != nil {
+		log.Printf("Error saving logo: %v", err)
+		http.Error(w, "Failed to save logo", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (h *Handler) handleGetLogo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	logo, err := h.store.GetLogo(id)
+	if err != nil {
+		log.Printf("Error getting logo: %v", err)
+		http.Error(w, "Failed to get logo", http.StatusInternalServerError)
+		return
+	}
+	if logo == nil {
+		http.Error(w, "Logo not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", logo.ContentType)
+	if _, err := w.Write(logo.Data); err != nil {
+		log.Printf("Error writing logo: %v", err)
+	}
+}
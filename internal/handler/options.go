@@ -0,0 +1,509 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ironicbadger/qr-code-generator/internal/payload"
+	"github.com/ironicbadger/qr-code-generator/internal/qrcode"
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+// errLogoNotFound is returned when a code refers to a logo that does not exist.
+var errLogoNotFound = errors.New("logo not found")
+
+// requestError is a failure caused by the client, carrying the status and
+// message to report back.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...any) error {
+	return &requestError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus maps err to a response status and message. Errors that did not
+// come from the request are logged and reported as internalMessage.
+func errorStatus(err error, internalMessage string) (int, string) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status, reqErr.message
+	}
+	log.Printf("%s: %v", internalMessage, err)
+	return http.StatusInternalServerError, internalMessage
+}
+
+// codeRequest carries the user-supplied settings for a code, from either the
+// generate form or the JSON API.
+type codeRequest struct {
+	Content     string  `json:"content"`
+	Label       string  `json:"label"`
+	Level       string  `json:"level"`
+	Foreground  string  `json:"foreground"`
+	Background  string  `json:"background"`
+	LogoID      int64   `json:"logo_id"`
+	LogoPercent int     `json:"logo_percent"`
+	Size        int     `json:"size"`
+	SizeMM      float64 `json:"size_mm"`
+	DPI         int     `json:"dpi"`
+	Margin      *int    `json:"margin"`
+	Style       string  `json:"style"`
+	// PayloadType selects a structured payload whose fields are given in
+	// Payload. The encoded payload replaces Content.
+	PayloadType string          `json:"payload_type"`
+	Payload     json.RawMessage `json:"payload"`
+	// Persist stores a code whose payload type is sensitive, which is
+	// otherwise only rendered and returned.
+	Persist bool `json:"persist"`
+	// Dynamic encodes a short link that redirects to Content, so the
+	// destination can be changed after printing, optionally within limits.
+	Dynamic bool `json:"dynamic"`
+	// Slug is the vanity slug of a dynamic code's short link; without it
+	// one is generated.
+	Slug string `json:"slug"`
+	linkLimits
+	// Passphrase, if set, must be entered before a dynamic code redirects.
+	Passphrase string `json:"passphrase"`
+	// Rules send some scans of a dynamic code elsewhere than Content.
+	Rules []redirectRule `json:"rules"`
+	// Tags label the stored code for filtering the history.
+	Tags []string `json:"tags"`
+}
+
+// formRequest reads the generate form.
+func formRequest(r *http.Request) (*codeRequest, error) {
+	req := &codeRequest{
+		Content:    r.FormValue("content"),
+		Label:      r.FormValue("label"),
+		Level:      r.FormValue("level"),
+		Foreground: r.FormValue("foreground"),
+		Background: r.FormValue("background"),
+		Style:      r.FormValue("style"),
+		Persist:    r.FormValue("persist") != "",
+		Dynamic:    r.FormValue("dynamic") != "",
+		Slug:       r.FormValue("slug"),
+		Passphrase: r.FormValue("passphrase"),
+		Tags:       formTags(r),
+		linkLimits: linkLimits{
+			StartsAt:  r.FormValue("starts_at"),
+			ExpiresAt: r.FormValue("expires_at"),
+			Fallback:  r.FormValue("fallback"),
+		},
+	}
+	if r.FormValue("transparent") != "" {
+		req.Background = qrcode.Transparent
+	}
+
+	var err error
+	if typ := r.FormValue("payload_type"); typ != "" {
+		req.PayloadType = typ
+		if req.Payload, err = payloadFromForm(r, typ); err != nil {
+			return nil, err
+		}
+	}
+	if v := r.FormValue("logo_id"); v != "" {
+		if req.LogoID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, badRequest("invalid logo")
+		}
+	}
+	if v := r.FormValue("logo_percent"); v != "" && req.LogoID != 0 {
+		if req.LogoPercent, err = strconv.Atoi(v); err != nil {
+			return nil, badRequest("invalid logo size")
+		}
+	}
+	if v := r.FormValue("size_mm"); v != "" {
+		if req.SizeMM, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, badRequest("invalid print size")
+		}
+		if v := r.FormValue("dpi"); v != "" {
+			if req.DPI, err = strconv.Atoi(v); err != nil {
+				return nil, badRequest("invalid DPI")
+			}
+		}
+	} else if v := r.FormValue("size"); v != "" {
+		if req.Size, err = strconv.Atoi(v); err != nil {
+			return nil, badRequest("invalid size")
+		}
+	}
+	if v := r.FormValue("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, badRequest("invalid margin")
+		}
+		req.Margin = &margin
+	}
+	if v := r.FormValue("max_scans"); v != "" {
+		if req.MaxScans, err = strconv.Atoi(v); err != nil {
+			return nil, badRequest("invalid scan limit")
+		}
+	}
+	return req, nil
+}
+
+// requestFromCode is the inverse of code, used to apply partial updates to a
+// stored code.
+func requestFromCode(code *storage.QRCode) *codeRequest {
+	return &codeRequest{
+		Content:     code.Content,
+		Label:       code.Label,
+		Level:       code.ECLevel,
+		Foreground:  code.Foreground,
+		Background:  code.Background,
+		LogoID:      code.LogoID,
+		LogoPercent: code.LogoPercent,
+		Size:        code.Size,
+		Margin:      &code.Margin,
+		Style:       code.Style,
+		PayloadType: code.PayloadType,
+		Payload:     json.RawMessage(code.PayloadData),
+	}
+}
+
+// code validates the request and returns an unsaved code. Values are
+// normalised so that what gets stored can always be rendered again.
+func (req *codeRequest) code() (*storage.QRCode, error) {
+	code := &storage.QRCode{
+		Content: strings.TrimSpace(req.Content),
+		Label:   strings.TrimSpace(req.Label),
+	}
+	if req.PayloadType != "" {
+		if err := applyPayload(code, req.PayloadType, req.Payload); err != nil {
+			return nil, err
+		}
+	}
+	if code.Content == "" {
+		return nil, badRequest("content is required")
+	}
+
+	level, err := qrcode.ParseLevel(req.Level)
+	if err != nil {
+		return nil, badRequest("invalid error correction level")
+	}
+	code.ECLevel = string(level)
+
+	code.Foreground = storage.DefaultForeground
+	if req.Foreground != "" {
+		c, err := qrcode.ParseColor(req.Foreground)
+		if err != nil {
+			return nil, badRequest("invalid foreground colour")
+		}
+		code.Foreground = qrcode.FormatColor(c)
+	}
+	code.Background = storage.DefaultBackground
+	if req.Background != "" {
+		c, err := qrcode.ParseColor(req.Background)
+		if err != nil {
+			return nil, badRequest("invalid background colour")
+		}
+		code.Background = qrcode.FormatColor(c)
+	}
+
+	if req.LogoID < 0 {
+		return nil, badRequest("invalid logo")
+	}
+	if req.LogoID != 0 {
+		code.LogoID = req.LogoID
+		code.LogoPercent = req.LogoPercent
+		if code.LogoPercent == 0 {
+			code.LogoPercent = qrcode.DefaultLogoPercent
+		}
+	}
+
+	if level, ok := payload.RequiredLevel(code.PayloadType); ok {
+		if code.LogoID != 0 {
+			return nil, badRequest("%s codes must use error correction level %s and cannot carry a logo", code.PayloadType, level)
+		}
+		code.ECLevel = level
+	}
+	if code.PayloadType == payload.TypeSwissBill &&
+		(code.Foreground != storage.DefaultForeground || code.Background != storage.DefaultBackground) {
+		return nil, badRequest("Swiss QR-bills are printed black on white")
+	}
+
+	code.Size = storage.DefaultSize
+	switch {
+	case req.SizeMM != 0:
+		size, err := printSize(req.SizeMM, req.DPI)
+		if err != nil {
+			return nil, badRequest("%s", err.Error())
+		}
+		code.Size = size
+	case req.Size != 0:
+		if err := checkSize(req.Size); err != nil {
+			return nil, badRequest("%s", err.Error())
+		}
+		code.Size = req.Size
+	}
+	code.Margin = storage.DefaultMargin
+	if req.Margin != nil {
+		if *req.Margin < 0 || *req.Margin > maxMargin {
+			return nil, badRequest("margin must be between 0 and %d", maxMargin)
+		}
+		code.Margin = *req.Margin
+	}
+	style, err := qrcode.ParseStyle(req.Style)
+	if err != nil {
+		return nil, badRequest("invalid style")
+	}
+	code.Style = string(style)
+
+	return code, nil
+}
+
+// sensitive reports whether req is for a code that carries credentials. The
+// content only counts without a payload, which replaces it.
+func (req *codeRequest) sensitive() bool {
+	if req.PayloadType != "" {
+		return sensitive(req.PayloadType)
+	}
+	return secretContent(strings.TrimSpace(req.Content))
+}
+
+// ephemeral reports whether req is for a code that must not be stored.
+func (req *codeRequest) ephemeral() bool {
+	return req.sensitive() && !req.Persist
+}
+
+// renderEphemeral validates req and renders its image without saving it.
+func (h *Handler) renderEphemeral(req *codeRequest) ([]byte, error) {
+	code, err := req.code()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.renderCode(code); err != nil {
+		return nil, err
+	}
+	return code.ImageData, nil
+}
+
+// createCode validates req, renders its image and saves it with its tags.
+// Dynamic codes are returned with their link.
+func (h *Handler) createCode(r *http.Request, req *codeRequest) (*storage.QRCode, *storage.Link, error) {
+	tags, err := checkTags(req.Tags)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Tags = tags
+
+	if req.Dynamic {
+		return h.createDynamic(r, req)
+	}
+	if req.Slug != "" || !req.linkLimits.isZero() || req.Passphrase != "" || len(req.Rules) > 0 {
+		return nil, nil, badRequest("slugs, expiry, scan limits, fallbacks, passphrases and rules need a dynamic code")
+	}
+	code, err := req.code()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := h.renderCode(code); err != nil {
+		return nil, nil, err
+	}
+	code, err = h.store.Insert(code, req.Tags...)
+	return code, nil, err
+}
+
+// renderCode generates the PNG for code from its stored settings, filling in
+// ImageData, the effective ECLevel and Verification.
+func (h *Handler) renderCode(code *storage.QRCode) error {
+	opts, err := h.renderOptions(code)
+	if errors.Is(err, errLogoNotFound) {
+		return badRequest("logo not found")
+	}
+	if err != nil {
+		return err
+	}
+	code.ECLevel = string(opts.EffectiveLevel())
+
+	code.ImageData, err = h.generator.GeneratePNG(code.Content, opts)
+	if err != nil {
+		if qrcode.IsOptionError(err) {
+			return badRequest("%s", err.Error())
+		}
+		if errors.Is(err, qrcode.ErrVerificationFailed) {
+			// The error repeats the decoded content, which may be a secret.
+			if secretCode(code) {
+				log.Printf("Generated QR code with a secret failed verification")
+			} else {
+				log.Printf("Generated QR code failed verification: %v", err)
+			}
+			return &requestError{
+				status:  http.StatusUnprocessableEntity,
+				message: "Generated QR code does not scan; try a higher error correction level or a smaller logo",
+			}
+		}
+		return err
+	}
+
+	code.Verification = storage.VerificationUnverified
+	if h.generator.Verifies() {
+		code.Verification = storage.VerificationVerified
+	}
+	return nil
+}
+
+// renderOptions turns the render settings stored with a code into generator
+// options, loading its logo if it has one. Unparseable values, which only a
+// hand-edited database could contain, keep the defaults.
+func (h *Handler) renderOptions(code *storage.QRCode) (qrcode.Options, error) {
+	opts := qrcode.DefaultOptions()
+	if level, err := qrcode.ParseLevel(code.ECLevel); err == nil {
+		opts.Level = level
+	}
+	if fg, err := qrcode.ParseColor(code.Foreground); err == nil {
+		opts.Foreground = fg
+	}
+	if bg, err := qrcode.ParseColor(code.Background); err == nil {
+		opts.Background = bg
+	}
+	if style, err := qrcode.ParseStyle(code.Style); err == nil {
+		opts.Style = style
+	}
+	if code.Size > 0 {
+		opts.Size = code.Size
+	}
+	if code.Margin >= 0 && code.Margin <= maxMargin {
+		opts.QuietZone = code.Margin
+	}
+	// QR-bills set their own quiet zone and print size.
+	opts.SwissQRBill = code.PayloadType == payload.TypeSwissBill
+
+	if code.LogoID != 0 {
+		logo, err := h.store.GetLogo(code.LogoID)
+		if err != nil {
+			return opts, err
+		}
+		if logo == nil {
+			return opts, errLogoNotFound
+		}
+		img, _, err := qrcode.DecodeLogo(logo.Data)
+		if err != nil {
+			return opts, err
+		}
+		opts.Logo = img
+		opts.LogoPercent = code.LogoPercent
+	}
+	return opts, nil
+}
+
+// wantsSVG reports whether the client asked for vector output, either with
+// ?format=svg or by preferring image/svg+xml in its Accept header.
+func wantsSVG(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.EqualFold(format, "svg")
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if strings.EqualFold(mediaType, "image/svg+xml") {
+			return true
+		}
+	}
+	return false
+}
+
+// maxMargin bounds the quiet zone, in modules.
+const maxMargin = 20
+
+// svgOptions applies the optional module and margin query parameters.
+func svgOptions(r *http.Request, opts *qrcode.Options) error {
+	query := r.URL.Query()
+	if v := query.Get("module"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return fmt.Errorf("module must be between 1 and 100")
+		}
+		opts.ModuleSize = n
+	}
+	return marginOption(r, opts)
+}
+
+// pngOptions applies the optional size and margin query parameters.
+func pngOptions(r *http.Request, opts *qrcode.Options) error {
+	size, err := sizeQuery(r)
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		opts.Size = size
+	}
+	return marginOption(r, opts)
+}
+
+// Print sizes are given in millimetres at a resolution in dots per inch.
+const (
+	defaultDPI = 300
+	minDPI     = 72
+	maxDPI     = 1200
+	mmPerInch  = 25.4
+)
+
+// sizeQuery reads a pixel size from ?size=, or a print size from ?size_mm=
+// and ?dpi=. It returns 0 when neither is given.
+func sizeQuery(r *http.Request) (int, error) {
+	query := r.URL.Query()
+	if v := query.Get("size_mm"); v != "" {
+		mm, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid print size")
+		}
+		dpi := 0
+		if v := query.Get("dpi"); v != "" {
+			if dpi, err = strconv.Atoi(v); err != nil {
+				return 0, fmt.Errorf("invalid DPI")
+			}
+		}
+		return printSize(mm, dpi)
+	}
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid size")
+		}
+		return size, checkSize(size)
+	}
+	return 0, nil
+}
+
+// printSize converts a printed width in millimetres to pixels at dpi, which
+// defaults to defaultDPI. The result must still fall within the pixel bounds.
+func printSize(mm float64, dpi int) (int, error) {
+	if dpi == 0 {
+		dpi = defaultDPI
+	}
+	if dpi < minDPI || dpi > maxDPI {
+		return 0, fmt.Errorf("DPI must be between %d and %d", minDPI, maxDPI)
+	}
+	size := int(math.Round(mm / mmPerInch * float64(dpi)))
+	if err := checkSize(size); err != nil {
+		return 0, fmt.Errorf("%g mm at %d DPI is %d px; %w", mm, dpi, size, err)
+	}
+	return size, nil
+}
+
+func checkSize(size int) error {
+	if size < minRenderSize || size > maxRenderSize {
+		return fmt.Errorf("size must be between %d and %d pixels", minRenderSize, maxRenderSize)
+	}
+	return nil
+}
+
+func marginOption(r *http.Request, opts *qrcode.Options) error {
+	if v := r.URL.Query().Get("margin"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxMargin {
+			return fmt.Errorf("margin must be between 0 and %d", maxMargin)
+		}
+		opts.QuietZone = n
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passphrase limits. bcrypt ignores everything past 72 bytes, so longer
+// passphrases are rejected rather than silently truncated.
+const (
+	minPassphraseChars = 8
+	maxPassphraseBytes = 72
+	maxUnlockBodyBytes = 4 << 10
+)
+
+// An unlocked link stays open in the browser for accessTTL. After
+// maxUnlockFailures wrong passphrases from one client within unlockWindow,
+// a code refuses further attempts from that client until the window has
+// passed. After maxCodeUnlockFailures from all clients, each client only has
+// maxLockedUnlockFailures.
+const (
+	accessTTL               = 10 * time.Minute
+	accessCookie            = "qr_access"
+	maxUnlockFailures       = 5
+	maxCodeUnlockFailures   = 100
+	maxLockedUnlockFailures = 1
+	unlockWindow            = 15 * time.Minute
+)
+
+// hashPassphrase validates a new passphrase and returns its bcrypt hash.
+func hashPassphrase(passphrase string) (string, error) {
+	if utf8.RuneCountInString(passphrase) < minPassphraseChars {
+		return "", badRequest("passphrase must be at least %d characters", minPassphraseChars)
+	}
+	if len(passphrase) > maxPassphraseBytes {
+		return "", badRequest("passphrase must be at most %d bytes", maxPassphraseBytes)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash passphrase: %w", err)
+	}
+	return string(hash), nil
+}
+
+// newAccessKey returns a random key for signing access cookies. Cookies do
+// not outlive the process, which is well beyond accessTTL in practice.
+func newAccessKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return key
+}
+
+// accessToken signs access to link until expires. The passphrase hash is
+// part of the signature, so changing the passphrase revokes open sessions.
+func (h *Handler) accessToken(link *storage.Link, expires time.Time) string {
+	mac := hmac.New(sha256.New, h.accessKey)
+	fmt.Fprintf(mac, "%d|%s|%d", link.CodeID, link.PassphraseHash, expires.Unix())
+	return strconv.FormatInt(expires.Unix(), 10) + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// hasAccess reports whether the request carries an unexpired access cookie
+// for link.
+func (h *Handler) hasAccess(r *http.Request, link *storage.Link, now time.Time) bool {
+	cookie, err := r.Cookie(accessCookie)
+	if err != nil {
+		return false
+	}
+	ts, _, _ := strings.Cut(cookie.Value, ".")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return false
+	}
+	return hmac.Equal([]byte(cookie.Value), []byte(h.accessToken(link, expires)))
+}
+
+// grantAccess sets the access cookie for link, scoped to its short link.
+func (h *Handler) grantAccess(w http.ResponseWriter, r *http.Request, link *storage.Link, now time.Time) {
+	expires := now.Add(accessTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookie,
+		Value:    h.accessToken(link, expires),
+		Path:     "/r/" + link.Slug,
+		Expires:  expires,
+		MaxAge:   int(accessTTL.Seconds()),
+		Secure:   h.requestScheme(r) == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// unlockLimiter counts wrong passphrases per code and client, so one client
+// guessing cannot lock everyone else out, and per code, so a protected code
+// cannot be brute-forced however many clients try: once a code has seen
+// maxCodeUnlockFailures, each client gets only maxLockedUnlockFailures.
+// Counts are kept in memory, dropped once their window has passed, and start
+// afresh when the server restarts.
+type unlockLimiter struct {
+	mu       sync.Mutex
+	failures map[unlockKey]*unlockFailures
+	swept    time.Time
+}
+
+// unlockKey identifies a count; the code-wide one has no client.
+type unlockKey struct {
+	codeID int64
+	client string
+}
+
+type unlockFailures struct {
+	count int
+	since time.Time
+}
+
+func newUnlockLimiter() *unlockLimiter {
+	return &unlockLimiter{failures: make(map[unlockKey]*unlockFailures)}
+}
+
+// attempt reserves a passphrase attempt by client on a code and returns 0,
+// or how long to wait if too many have failed. An attempt counts as failed
+// until it is forgiven, so concurrent guesses cannot get past the limit.
+func (l *unlockLimiter) attempt(codeID int64, client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	codeKey, clientKey := unlockKey{codeID, ""}, unlockKey{codeID, client}
+	allowed := maxUnlockFailures
+	if code := l.live(codeKey, now); code != nil && code.count >= maxCodeUnlockFailures {
+		allowed = maxLockedUnlockFailures
+	}
+	if mine := l.live(clientKey, now); mine != nil && mine.count >= allowed {
+		return mine.since.Add(unlockWindow).Sub(now)
+	}
+	l.count(codeKey, now)
+	l.count(clientKey, now)
+	return 0
+}
+
+// live returns the count of key, or nil if there is none in the window.
+func (l *unlockLimiter) live(key unlockKey, now time.Time) *unlockFailures {
+	if f := l.failures[key]; f != nil && now.Before(f.since.Add(unlockWindow)) {
+		return f
+	}
+	return nil
+}
+
+// count adds an attempt to key, starting a new window if needed.
+func (l *unlockLimiter) count(key unlockKey, now time.Time) {
+	f := l.live(key, now)
+	if f == nil {
+		f = &unlockFailures{since: now}
+		l.failures[key] = f
+	}
+	f.count++
+}
+
+// sweep drops the counts whose window has passed, at most once a window, so
+// clients that never return do not pile up.
+func (l *unlockLimiter) sweep(now time.Time) {
+	if now.Before(l.swept.Add(unlockWindow)) {
+		return
+	}
+	for key := range l.failures {
+		if l.live(key, now) == nil {
+			delete(l.failures, key)
+		}
+	}
+	l.swept = now
+}
+
+// forgive takes back the attempt of a correct passphrase.
+func (l *unlockLimiter) forgive(codeID int64, client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range []unlockKey{{codeID, ""}, {codeID, client}} {
+		if f := l.failures[key]; f != nil {
+			if f.count--; f.count <= 0 {
+				delete(l.failures, key)
+			}
+		}
+	}
+}
+
+// unlockClient returns the client an unlock attempt is counted against: its
+// IPv4 address, or the /64 network of an IPv6 address, as a single host
+// usually holds a whole /64.
+func unlockClient(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, _ := addr.Prefix(64)
+	return prefix.String()
+}
+
+// handleUnlock checks the passphrase entered on the interstitial page of a
+// protected code and, if it matches, redirects the scan on.
+func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	link, err := h.store.GetLink(r.PathValue("slug"))
+	if err != nil {
+		log.Printf("Error getting link: %v", err)
+		http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
+		return
+	}
+	if link == nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	now := time.Now()
+	if link.PassphraseHash == "" || link.Status(now) != storage.LinkActive {
+		h.followLink(w, r, link, http.StatusSeeOther)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	client := unlockClient(h.clientIP(r))
+	if wait := h.unlocks.attempt(link.CodeID, client, now); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		h.serveUnlock(w, link, "Too many wrong passphrases. Try again later.", http.StatusTooManyRequests)
+		return
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(link.PassphraseHash), []byte(r.FormValue("passphrase")))
+	if err != nil {
+		h.serveUnlock(w, link, "Wrong passphrase.", http.StatusForbidden)
+		return
+	}
+	h.unlocks.forgive(link.CodeID, client)
+
+	h.grantAccess(w, r, link, now)
+	h.followLink(w, r, link, http.StatusSeeOther)
+}
+
+// serveUnlock shows the passphrase form of a protected code.
+func (h *Handler) serveUnlock(w http.ResponseWriter, link *storage.Link, message string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := struct {
+		Slug  string
+		Error string
+	}{link.Slug, message}
+	if err := h.templates.ExecuteTemplate(w, "unlock.html", data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unlock posts a passphrase to the interstitial form of slug.
+func unlock(h *Handler, slug, passphrase string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	return unlockFrom(h, slug, passphrase, "192.0.2.1:1234", cookies...)
+}
+
+// unlockFrom posts a passphrase from the client at remoteAddr.
+func unlockFrom(h *Handler, slug, passphrase, remoteAddr string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	form := url.Values{"passphrase": {passphrase}}
+	req := httptest.NewRequest(http.MethodPost, "/r/"+slug, strings.NewReader(form.Encode()))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestProtectedCodes(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com/doc","dynamic":true,"passphrase":"open sesame"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+	if !code.Protected || strings.Contains(w.Body.String(), "sesame") || strings.Contains(w.Body.String(), "$2a$") {
+		t.Errorf("Expected a protected code without its passphrase or hash, got %s", w.Body.String())
+	}
+
+	// Scans get the passphrase form instead of a redirect
+	w = apiRequest(t, h, http.MethodGet, "/r/"+code.Slug, "")
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" || !strings.Contains(w.Body.String(), `action="/r/`+code.Slug+`"`) {
+		t.Fatalf("Expected the passphrase form, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = unlock(h, code.Slug, "wrong passphrase")
+	if w.Code != http.StatusForbidden || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected 403 without a cookie, got %d", w.Code)
+	}
+
+	w = unlock(h, code.Slug, "open sesame")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "https://example.com/doc" {
+		t.Fatalf("Expected redirect to the target, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Path != "/r/"+code.Slug || cookies[0].MaxAge != int(accessTTL.Seconds()) {
+		t.Fatalf("Unexpected access cookie %+v", cookies)
+	}
+
+	// The cookie lets later scans through
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	scan := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/r/"+code.Slug, nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	if w := scan(cookies[0]); w.Code != http.StatusFound {
+		t.Errorf("Expected the cookie to allow a redirect, got %d", w.Code)
+	}
+	forged := *cookies[0]
+	forged.Value = strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + strings.TrimLeft(forged.Value, "0123456789")
+	if w := scan(&forged); w.Code != http.StatusOK {
+		t.Errorf("Expected a cookie with a changed expiry to be rejected, got %d", w.Code)
+	}
+
+	// Changing the passphrase revokes the cookie
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(code.ID, 10)
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"passphrase":"new passphrase"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := scan(cookies[0]); w.Code != http.StatusOK {
+		t.Errorf("Expected the old cookie to be rejected, got %d", w.Code)
+	}
+
+	// Removing the passphrase opens the code
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"passphrase":""}`)
+	var open apiCode
+	decodeAPIResponse(t, w, &open)
+	if open.Protected {
+		t.Error("Expected the code to be unprotected")
+	}
+	w = apiRequest(t, h, http.MethodGet, "/r/"+code.Slug, "")
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected a redirect, got %d", w.Code)
+	}
+
+	for _, body := range []string{
+		`{"content":"https://example.com","dynamic":true,"passphrase":"short"}`,
+		`{"content":"https://example.com","dynamic":true,"passphrase":"` + strings.Repeat("a", maxPassphraseBytes+1) + `"}`,
+		`{"content":"https://example.com","passphrase":"open sesame"}`,
+	} {
+		w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %.80s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestUnlockRateLimit(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true,"passphrase":"open sesame"}`)
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+
+	for i := 0; i < maxUnlockFailures; i++ {
+		if w := unlock(h, code.Slug, "guess"); w.Code != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected 403, got %d", i+1, w.Code)
+		}
+	}
+	// Once locked, even the right passphrase is refused
+	w = unlock(h, code.Slug, "open sesame")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", w.Code)
+	}
+
+	// Other clients are not locked out
+	w = unlockFrom(h, code.Slug, "open sesame", "198.51.100.7:1234")
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("Expected another client to unlock with 303, got %d", w.Code)
+	}
+
+	// The lock ends with the window
+	later := time.Now().Add(unlockWindow)
+	if wait := h.unlocks.attempt(code.ID, "192.0.2.1", later); wait != 0 {
+		t.Errorf("Expected attempts to be allowed after the window, got wait %v", wait)
+	}
+
+	// Successful attempts do not count towards the limit
+	limiter := newUnlockLimiter()
+	now := time.Now()
+	for i := 0; i < 2*maxUnlockFailures; i++ {
+		if wait := limiter.attempt(1, "192.0.2.1", now); wait != 0 {
+			t.Fatalf("Attempt %d: expected no wait, got %v", i+1, wait)
+		}
+		limiter.forgive(1, "192.0.2.1")
+	}
+
+	// Past the code-wide cap, every client is down to one attempt, but
+	// clients that have not guessed yet still get theirs
+	for i := 0; i < maxCodeUnlockFailures; i++ {
+		client := "client" + strconv.Itoa(i/maxUnlockFailures)
+		if wait := limiter.attempt(2, client, now); wait != 0 {
+			t.Fatalf("Attempt %d: expected no wait, got %v", i+1, wait)
+		}
+	}
+	if wait := limiter.attempt(2, "client0", now); wait == 0 {
+		t.Error("Expected a guessing client to be refused past the code-wide cap")
+	}
+	if wait := limiter.attempt(2, "newcomer", now); wait != 0 {
+		t.Errorf("Expected a new client to get one attempt, got wait %v", wait)
+	}
+	if wait := limiter.attempt(2, "newcomer", now); wait == 0 {
+		t.Error("Expected a new client to get only one attempt past the code-wide cap")
+	}
+	if wait := limiter.attempt(1, "another client", now); wait != 0 {
+		t.Errorf("Expected other codes to be unaffected, got wait %v", wait)
+	}
+	// Refused attempts do not add clients
+	entries := len(limiter.failures)
+	limiter.attempt(2, "client1", now)
+	if len(limiter.failures) != entries {
+		t.Errorf("Expected a refused attempt to add no count, got %d entries from %d", len(limiter.failures), entries)
+	}
+
+	// Counts are dropped once their window has passed
+	limiter.attempt(3, "latecomer", now.Add(unlockWindow))
+	if len(limiter.failures) != 2 {
+		t.Errorf("Expected only the latest counts to be kept, got %d", len(limiter.failures))
+	}
+}
+
+func TestUnlockClient(t *testing.T) {
+	for ip, want := range map[string]string{
+		"192.0.2.1":            "192.0.2.1",
+		"::ffff:192.0.2.1":     "192.0.2.1",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::1": "2001:db8:1:2::/64",
+		"not an address":       "not an address",
+	} {
+		if got := unlockClient(ip); got != want {
+			t.Errorf("unlockClient(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ironicbadger/qr-code-generator/internal/payload"
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+// applyPayload validates a structured payload and stores both its encoded
+// text, as the code's content, and its normalised fields.
+func applyPayload(code *storage.QRCode, typ string, data json.RawMessage) error {
+	p, err := payload.Parse(typ, data)
+	if err != nil {
+		return badRequest("%s", err.Error())
+	}
+	content, err := p.Encode()
+	if err != nil {
+		return badRequest("%s", err.Error())
+	}
+	fields, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	code.Content = content
+	code.PayloadType = p.Type()
+	code.PayloadData = string(fields)
+	if u, ok := p.(*payload.URL); ok {
+		code.Campaign = u.Campaign
+	}
+	return nil
+}
+
+// sensitive reports whether codes of payload type typ carry credentials.
+func sensitive(typ string) bool {
+	k, _ := payload.Lookup(typ)
+	return k.Sensitive
+}
+
+// secretCode reports whether a stored code carries credentials, either as a
+// sensitive payload or as an otpauth URI entered as plain content.
+func secretCode(code *storage.QRCode) bool {
+	return sensitive(code.PayloadType) || secretContent(code.Content)
+}
+
+// writeEphemeral sends the image of a code that was not stored. It must not
+// be kept by the browser or any cache in between.
+func writeEphemeral(w http.ResponseWriter, image []byte) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(image); err != nil {
+		log.Printf("Error writing QR image: %v", err)
+	}
+}
+
+// payloadFromForm reads the fields of a structured payload form as JSON, in
+// the same shape the API accepts.
+func payloadFromForm(r *http.Request, typ string) (json.RawMessage, error) {
+	var p payload.Payload
+	switch typ {
+	case payload.TypeURL:
+		p = &payload.URL{
+			URL:      r.FormValue("url"),
+			Source:   r.FormValue("utm_source"),
+			Medium:   r.FormValue("utm_medium"),
+			Campaign: r.FormValue("utm_campaign"),
+			Term:     r.FormValue("utm_term"),
+			Content:  r.FormValue("utm_content"),
+		}
+	case payload.TypeWiFi:
+		p = &payload.WiFi{
+			SSID:     r.FormValue("ssid"),
+			Security: r.FormValue("security"),
+			Password: r.FormValue("password"),
+			Hidden:   r.FormValue("hidden") != "",
+		}
+	case payload.TypeContact:
+		p = &payload.Contact{
+			Format:     r.FormValue("format"),
+			FirstName:  strings.TrimSpace(r.FormValue("first_name")),
+			LastName:   strings.TrimSpace(r.FormValue("last_name")),
+			Org:        strings.TrimSpace(r.FormValue("org")),
+			Phones:     formLines(r, "phones"),
+			Emails:     formLines(r, "emails"),
+			URL:        strings.TrimSpace(r.FormValue("url")),
+			Street:     strings.TrimSpace(r.FormValue("street")),
+			City:       strings.TrimSpace(r.FormValue("city")),
+			Region:     strings.TrimSpace(r.FormValue("region")),
+			PostalCode: strings.TrimSpace(r.FormValue("postal_code")),
+			Country:    strings.TrimSpace(r.FormValue("country")),
+		}
+	case payload.TypeEvent:
+		p = &payload.Event{
+			Title:       strings.TrimSpace(r.FormValue("title")),
+			Start:       r.FormValue("start"),
+			End:         r.FormValue("end"),
+			TimeZone:    r.FormValue("time_zone"),
+			EndTimeZone: r.FormValue("end_time_zone"),
+			AllDay:      r.FormValue("all_day") != "",
+			Location:    strings.TrimSpace(r.FormValue("location")),
+			Description: strings.TrimSpace(r.FormValue("description")),
+		}
+	case payload.TypeSMS:
+		p = &payload.SMS{
+			Number:  r.FormValue("number"),
+			Message: r.FormValue("message"),
+		}
+	case payload.TypePhone:
+		p = &payload.Phone{Number: r.FormValue("number")}
+	case payload.TypeEmail:
+		p = &payload.Email{
+			To:      r.FormValue("to"),
+			Subject: strings.TrimSpace(r.FormValue("subject")),
+			Body:    r.FormValue("body"),
+		}
+	case payload.TypeGeo:
+		p = &payload.Geo{
+			Latitude:  r.FormValue("latitude"),
+			Longitude: r.FormValue("longitude"),
+			Label:     strings.TrimSpace(r.FormValue("place")),
+		}
+	case payload.TypeOTP:
+		otp := &payload.OTP{
+			Kind:      r.FormValue("kind"),
+			Issuer:    strings.TrimSpace(r.FormValue("issuer")),
+			Account:   strings.TrimSpace(r.FormValue("account")),
+			Secret:    r.FormValue("secret"),
+			Algorithm: r.FormValue("algorithm"),
+		}
+		var err error
+		if v := r.FormValue("digits"); v != "" {
+			if otp.Digits, err = strconv.Atoi(v); err != nil {
+				return nil, badRequest("invalid digits")
+			}
+		}
+		if v := r.FormValue("period"); v != "" {
+			if otp.Period, err = strconv.Atoi(v); err != nil {
+				return nil, badRequest("invalid period")
+			}
+		}
+		if v := r.FormValue("counter"); v != "" {
+			if otp.Counter, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, badRequest("invalid counter")
+			}
+		}
+		p = otp
+	case payload.TypePayment:
+		p = &payload.Payment{
+			Beneficiary: strings.TrimSpace(r.FormValue("beneficiary")),
+			IBAN:        r.FormValue("iban"),
+			BIC:         r.FormValue("bic"),
+			Amount:      strings.TrimSpace(r.FormValue("amount")),
+			Currency:    r.FormValue("currency"),
+			Purpose:     strings.TrimSpace(r.FormValue("purpose")),
+			Reference:   strings.TrimSpace(r.FormValue("reference")),
+			Remittance:  strings.TrimSpace(r.FormValue("remittance")),
+			Info:        strings.TrimSpace(r.FormValue("info")),
+		}
+	case payload.TypeSwissBill:
+		bill := &payload.SwissBill{
+			IBAN:          r.FormValue("iban"),
+			Creditor:      swissAddressFromForm(r, "creditor_"),
+			Amount:        strings.TrimSpace(r.FormValue("amount")),
+			Currency:      r.FormValue("currency"),
+			ReferenceType: r.FormValue("reference_type"),
+			Reference:     r.FormValue("reference"),
+			Message:       strings.TrimSpace(r.FormValue("message")),
+			BillInfo:      strings.TrimSpace(r.FormValue("bill_info")),
+		}
+		// The debtor is optional; a blank section leaves it out.
+		if debtor := swissAddressFromForm(r, "debtor_"); debtor != (payload.SwissAddress{}) {
+			bill.Debtor = &debtor
+		}
+		p = bill
+	default:
+		return nil, badRequest("unknown payload type %q", typ)
+	}
+	return json.Marshal(p)
+}
+
+// swissAddressFromForm reads the address fields named with prefix.
+func swissAddressFromForm(r *http.Request, prefix string) payload.SwissAddress {
+	return payload.SwissAddress{
+		Name:           strings.TrimSpace(r.FormValue(prefix + "name")),
+		Street:         strings.TrimSpace(r.FormValue(prefix + "street")),
+		BuildingNumber: strings.TrimSpace(r.FormValue(prefix + "building_number")),
+		PostalCode:     strings.TrimSpace(r.FormValue(prefix + "postal_code")),
+		Town:           strings.TrimSpace(r.FormValue(prefix + "town")),
+		Country:        strings.TrimSpace(r.FormValue(prefix + "country")),
+	}
+}
+
+// listFilter reads a payload type filter from the query parameter typeKey,
+// a UTM campaign from campaign, a tag from tag and a collection ID from
+// collection. It accepts any registered payload type, or storage.PlainText
+// for codes without one.
+func listFilter(r *http.Request, typeKey string) (storage.Filter, error) {
+	query := r.URL.Query()
+	typ := query.Get(typeKey)
+	if _, ok := payload.Lookup(typ); !ok && typ != "" && typ != storage.PlainText {
+		return storage.Filter{}, badRequest("unknown payload type %q", typ)
+	}
+	filter := storage.Filter{
+		PayloadType: typ,
+		Campaign:    query.Get("campaign"),
+		Tag:         strings.ToLower(strings.TrimSpace(query.Get("tag"))),
+	}
+	if v := query.Get("collection"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			return storage.Filter{}, badRequest("invalid collection")
+		}
+		filter.CollectionID = id
+	}
+	return filter, nil
+}
+
+// formLines splits a multi-line form field into its non-empty lines.
+func formLines(r *http.Request, key string) []string {
+	var lines []string
+	for _, line := range strings.Split(r.FormValue(key), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// codeView is a code as listed on the index page.
+type codeView struct {
+	*storage.QRCode
+	// Summary describes a structured payload in place of its raw content.
+	Summary string
+	// Link and LinkStatus are set for dynamic codes.
+	Link       *storage.Link
+	LinkStatus storage.LinkStatus
+	// Tags and Collections organise the code.
+	Tags        []string
+	Collections []*storage.Collection
+}
+
+func codeViews(codes []*storage.QRCode, links map[int64]*storage.Link) []codeView {
+	now := time.Now()
+	views := make([]codeView, len(codes))
+	for i, code := range codes {
+		views[i].QRCode = code
+		if link := links[code.ID]; link != nil {
+			views[i].Link = link
+			views[i].LinkStatus = link.Status(now)
+		}
+		if code.PayloadType == "" {
+			continue
+		}
+		if p, err := payload.Parse(code.PayloadType, []byte(code.PayloadData)); err == nil {
+			views[i].Summary = p.Summary()
+		}
+	}
+	return views
+}
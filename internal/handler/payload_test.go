@@ -0,0 +1,471 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+func TestHandleGenerateWiFi(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{
+		"payload_type": {"wifi"},
+		"ssid":         {"Cafe; Guest"},
+		"security":     {"WPA"},
+		"password":     {"pass:word1"},
+		"hidden":       {"on"},
+		"content":      {"ignored"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 1 {
+		t.Fatalf("Expected 1 QR code, got %d", len(codes))
+	}
+	code := codes[0]
+	if want := `WIFI:T:WPA;S:Cafe\; Guest;P:pass\:word1;H:true;;`; code.Content != want {
+		t.Errorf("Expected content %q, got %q", want, code.Content)
+	}
+	if code.PayloadType != "wifi" || !strings.Contains(code.PayloadData, `"ssid":"Cafe; Guest"`) {
+		t.Errorf("Expected stored Wi-Fi fields, got %q %q", code.PayloadType, code.PayloadData)
+	}
+	if views := codeViews(codes, nil); views[0].Summary != "Wi-Fi: Cafe; Guest" {
+		t.Errorf("Unexpected summary %q", views[0].Summary)
+	}
+
+	// Invalid payloads are rejected
+	form.Set("password", "short")
+	req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestAPIEditWiFi(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes",
+		`{"payload_type":"wifi","payload":{"ssid":"Office","security":"WPA","password":"password1"},"label":"Office"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created apiCode
+	decodeAPIResponse(t, w, &created)
+	if created.Content != "WIFI:T:WPA;S:Office;P:password1;;" || created.PayloadType != "wifi" {
+		t.Errorf("Unexpected created code %+v", created)
+	}
+
+	// Change only the password
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/1",
+		`{"payload":{"ssid":"Office","security":"WPA","password":"password2"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated apiCode
+	decodeAPIResponse(t, w, &updated)
+	if updated.Content != "WIFI:T:WPA;S:Office;P:password2;;" || updated.Label != "Office" {
+		t.Errorf("Unexpected updated code %+v", updated)
+	}
+
+	// Plain content drops the payload
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/1", `{"content":"hello"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var plain apiCode
+	decodeAPIResponse(t, w, &plain)
+	if plain.Content != "hello" || plain.PayloadType != "" || plain.Payload != nil {
+		t.Errorf("Expected plain text code, got %+v", plain)
+	}
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"payload_type":"fax","payload":{}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown payload type, got %d", w.Code)
+	}
+}
+
+func TestHandleGenerateContact(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{
+		"payload_type": {"contact"},
+		"first_name":   {"Ada"},
+		"last_name":    {"Lovelace"},
+		"phones":       {"+44 20 7946 0958\r\n\r\n020 7946 0000\r\n"},
+		"emails":       {"ada@example.com"},
+		"format":       {"mecard"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 1 {
+		t.Fatalf("Expected 1 QR code, got %d", len(codes))
+	}
+	want := "MECARD:N:Lovelace,Ada;TEL:+44 20 7946 0958;TEL:020 7946 0000;EMAIL:ada@example.com;;"
+	if codes[0].Content != want {
+		t.Errorf("Expected content %q, got %q", want, codes[0].Content)
+	}
+	if views := codeViews(codes, nil); views[0].Summary != "Contact: Ada Lovelace" {
+		t.Errorf("Unexpected summary %q", views[0].Summary)
+	}
+
+	form.Set("emails", "not an email")
+	req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestAPIEditEvent(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes",
+		`{"payload_type":"event","payload":{"title":"Launch","start":"2026-05-01T18:00","time_zone":"Europe/London","location":"HQ"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created apiCode
+	decodeAPIResponse(t, w, &created)
+	if !strings.Contains(created.Content, "DTSTART:20260501T170000Z\r\n") {
+		t.Errorf("Expected UTC start in %q", created.Content)
+	}
+
+	// Moving the event re-renders it from the stored fields
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/1",
+		`{"payload":{"title":"Launch","start":"2026-05-02","all_day":true,"location":"HQ"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated apiCode
+	decodeAPIResponse(t, w, &updated)
+	if !strings.Contains(updated.Content, "DTSTART;VALUE=DATE:20260502\r\n") {
+		t.Errorf("Expected all-day start in %q", updated.Content)
+	}
+	if views := codeViews([]*storage.QRCode{{PayloadType: updated.PayloadType, PayloadData: string(updated.Payload)}}, nil); views[0].Summary != "Event: Launch (2026-05-02)" {
+		t.Errorf("Unexpected summary %q", views[0].Summary)
+	}
+}
+
+func TestAPIPaymentLevel(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes",
+		`{"level":"H","payload_type":"payment","payload":{"beneficiary":"Example GmbH","iban":"DE89 3704 0044 0532 0130 00","amount":"19.99"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created apiCode
+	decodeAPIResponse(t, w, &created)
+	if created.ECLevel != "M" {
+		t.Errorf("Expected mandated level M, got %s", created.ECLevel)
+	}
+	if !strings.Contains(string(created.Payload), `"iban":"DE89370400440532013000"`) {
+		t.Errorf("Expected normalised IBAN in %s", created.Payload)
+	}
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes",
+		`{"logo_id":1,"payload_type":"payment","payload":{"beneficiary":"Example GmbH","iban":"DE89370400440532013000"}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for payment with logo, got %d", w.Code)
+	}
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes",
+		`{"payload_type":"payment","payload":{"beneficiary":"Example GmbH","iban":"DE89370400440532013001"}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "checksum") {
+		t.Errorf("Expected checksum error, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleGenerateSwissBill(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{
+		"payload_type":         {"swissbill"},
+		"level":                {"L"},
+		"iban":                 {"CH44 3199 9123 0008 8901 2"},
+		"creditor_name":        {"Robert Schneider AG"},
+		"creditor_street":      {"Rue du Lac"},
+		"creditor_postal_code": {"2501"},
+		"creditor_town":        {"Biel"},
+		"creditor_country":     {"CH"},
+		"amount":               {"1949.75"},
+		"reference":            {"210000000003139471430009017"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected 1 QR code, got %d (%v)", len(codes), err)
+	}
+	code := codes[0]
+	if code.ECLevel != "M" {
+		t.Errorf("Expected mandated level M, got %s", code.ECLevel)
+	}
+	if strings.Contains(code.PayloadData, "debtor") || !strings.Contains(code.PayloadData, `"reference_type":"QRR"`) {
+		t.Errorf("Expected no debtor and a QR reference, got %s", code.PayloadData)
+	}
+
+	for format, want := range map[string]string{"svg": `mm" height="`, "pdf": "%PDF-1.4"} {
+		req = httptest.NewRequest(http.MethodGet, "/qr/1?format="+format, nil)
+		req.SetPathValue("id", "1")
+		w = httptest.NewRecorder()
+
+		h.handleGetQR(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", format, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != contentTypes[format] {
+			t.Errorf("Expected %s content type, got %s", format, got)
+		}
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %q in %s output", want, format)
+		}
+	}
+
+	// The cross and the symbol are black on white.
+	for _, colour := range []string{"transparent", "foreground"} {
+		form.Set(colour, "#000080")
+		req = httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+		h.handleGenerate(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for a QR-bill with a %s colour, got %d", colour, w.Code)
+		}
+		form.Del(colour)
+	}
+}
+
+func TestHandleGenerateSMS(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{
+		"payload_type": {"sms"},
+		"number":       {"+41 79 123 45 67"},
+		"message":      {"Table 4"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.handleGenerate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected 1 QR code, got %d (%v)", len(codes), err)
+	}
+	if codes[0].Content != "SMSTO:+41791234567:Table 4" || codes[0].PayloadType != "sms" {
+		t.Errorf("Unexpected code %q %q", codes[0].Content, codes[0].PayloadType)
+	}
+}
+
+func TestTypeFilter(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for _, body := range []string{
+		`{"content":"https://example.com"}`,
+		`{"payload_type":"phone","payload":{"number":"+41 44 668 18 00"}}`,
+		`{"payload_type":"geo","payload":{"latitude":"47.3769","longitude":"8.5417"}}`,
+		`{"payload_type":"phone","payload":{"number":"555 0100"}}`,
+	} {
+		if w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body); w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	for filter, want := range map[string]int{"": 4, "phone": 2, "geo": 1, "text": 1, "email": 0} {
+		w := apiRequest(t, h, http.MethodGet, "/api/v1/codes?payload_type="+filter, "")
+		var list struct {
+			Codes []apiCode `json:"codes"`
+			Total int       `json:"total"`
+		}
+		decodeAPIResponse(t, w, &list)
+		if list.Total != want || len(list.Codes) != want {
+			t.Errorf("Filter %q: expected %d codes, got %d of %d", filter, want, len(list.Codes), list.Total)
+		}
+	}
+
+	if w := apiRequest(t, h, http.MethodGet, "/api/v1/codes?payload_type=fax", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown type, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/?type=geo", nil)
+	w := httptest.NewRecorder()
+	h.handleIndex(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "geo:47.3769,8.5417") || strings.Contains(body, "tel:") {
+		t.Errorf("Expected only the location code, got %s", body)
+	}
+}
+
+func TestOTPIsEphemeral(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{
+		"payload_type": {"otp"},
+		"issuer":       {"Example"},
+		"account":      {"ops@example.com"},
+		"secret":       {"JBSWY3DPEHPK3PXP"},
+		"digits":       {"8"},
+	}
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.handleGenerate(w, req)
+		return w
+	}
+
+	w := post()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "image/png" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected an uncacheable PNG, got %q %q", w.Header().Get("Content-Type"), w.Header().Get("Cache-Control"))
+	}
+	if n, _ := h.store.Count(storage.Filter{}); n != 0 {
+		t.Fatalf("Expected OTP code not to be stored, got %d codes", n)
+	}
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes",
+		`{"payload_type":"otp","payload":{"issuer":"Example","account":"ops","secret":"JBSWY3DPEHPK3PXP"}}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected PNG from API, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if n, _ := h.store.Count(storage.Filter{}); n != 0 {
+		t.Fatalf("Expected OTP code not to be stored, got %d codes", n)
+	}
+
+	// An otpauth URI entered as plain content carries the same secret.
+	raw := url.Values{"content": {" otpauth://totp/Example:ops?secret=JBSWY3DPEHPK3PXP"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(raw.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.handleGenerate(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected an uncacheable PNG for raw otpauth content, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"OTPAUTH://totp/Example:ops?secret=JBSWY3DPEHPK3PXP"}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected PNG from API for raw otpauth content, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if n, _ := h.store.Count(storage.Filter{}); n != 0 {
+		t.Fatalf("Expected raw otpauth content not to be stored, got %d codes", n)
+	}
+
+	// Storing one is an explicit choice.
+	form.Set("persist", "on")
+	if w := post(); w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+	codes, _ := h.store.List(storage.Filter{PayloadType: "otp"}, 10, 0)
+	if len(codes) != 1 {
+		t.Fatalf("Expected persisted OTP code, got %d", len(codes))
+	}
+
+	// Its stored image is not cached either.
+	for _, target := range []string{"", "?size=512", "?format=svg"} {
+		req := httptest.NewRequest(http.MethodGet, "/qr/"+strconv.FormatInt(codes[0].ID, 10)+target, nil)
+		req.SetPathValue("id", strconv.FormatInt(codes[0].ID, 10))
+		w := httptest.NewRecorder()
+		h.handleGetQR(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Expected an uncacheable image for %q, got %d %q", target, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+
+	// Existing codes cannot be turned into OTP codes.
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"hello"}`)
+	var created apiCode
+	decodeAPIResponse(t, w, &created)
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/"+strconv.FormatInt(created.ID, 10),
+		`{"payload_type":"otp","payload":{"issuer":"Example","account":"ops","secret":"JBSWY3DPEHPK3PXP"}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for PATCH to OTP, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodPatch, "/api/v1/codes/"+strconv.FormatInt(created.ID, 10),
+		`{"content":"otpauth://totp/Example:ops?secret=JBSWY3DPEHPK3PXP"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for PATCH to raw otpauth content, got %d", w.Code)
+	}
+}
+
+func TestRenderOTPNotCached(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	data := url.QueryEscape("otpauth://totp/Example:ops?secret=JBSWY3DPEHPK3PXP")
+	req := httptest.NewRequest(http.MethodGet, "/render?data="+data, nil)
+	w := httptest.NewRecorder()
+	h.handleRender(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("ETag") != "" {
+		t.Errorf("Expected no-store without ETag, got %q %q", w.Header().Get("Cache-Control"), w.Header().Get("ETag"))
+	}
+	if h.cache.Len() != 0 {
+		t.Errorf("Expected OTP render to bypass the cache, got %d entries", h.cache.Len())
+	}
+}
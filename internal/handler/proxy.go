@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// SetTrustedProxies sets the reverse proxies, as a comma-separated list of
+// addresses and CIDR ranges, whose X-Forwarded-For and X-Forwarded-Proto
+// headers are believed. Without any, the headers are ignored, since any
+// client can send them.
+func (h *Handler) SetTrustedProxies(list string) error {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return fmt.Errorf("invalid proxy %q: must be an IP address or CIDR range", entry)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	h.trustedProxies = proxies
+	return nil
+}
+
+// trusted reports whether addr is one of the trusted proxies.
+func (h *Handler) trusted(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range h.trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address of the peer that sent r.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// clientIP returns the address of the client behind r. Requests from trusted
+// proxies are traced back through X-Forwarded-For to the nearest address
+// that is not a trusted proxy; entries further left were set by the client
+// and could be anything.
+func (h *Handler) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !h.trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !h.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// requestScheme returns the scheme the client used. X-Forwarded-Proto is
+// only believed from a trusted, TLS-terminating proxy.
+func (h *Handler) requestScheme(r *http.Request) string {
+	if r.TLS != nil || h.trusted(remoteIP(r)) && r.Header.Get("X-Forwarded-Proto") == "https" {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ironicbadger/qr-code-generator/internal/qrcode"
+)
+
+// Limits for the stateless render endpoint, which anyone can call without
+// creating a record.
+const (
+	maxRenderDataBytes = 1024
+	minRenderSize      = 64
+	maxRenderSize      = 2048
+	renderCacheMaxAge  = 86400
+)
+
+var contentTypes = map[string]string{
+	"png": "image/png",
+	"svg": "image/svg+xml",
+	"pdf": "application/pdf",
+}
+
+// renderRequest is the validated, normalised form of a /render query.
+type renderRequest struct {
+	data   string
+	format string
+	opts   qrcode.Options
+}
+
+func parseRenderRequest(r *http.Request) (*renderRequest, error) {
+	query := r.URL.Query()
+	req := &renderRequest{
+		data:   query.Get("data"),
+		format: strings.ToLower(query.Get("format")),
+		opts:   qrcode.DefaultOptions(),
+	}
+
+	if req.data == "" {
+		return nil, fmt.Errorf("data is required")
+	}
+	if len(req.data) > maxRenderDataBytes {
+		return nil, fmt.Errorf("data must be at most %d bytes", maxRenderDataBytes)
+	}
+
+	switch req.format {
+	case "":
+		req.format = "png"
+	case "png", "svg", "pdf":
+	default:
+		return nil, fmt.Errorf("format must be png, svg or pdf")
+	}
+
+	size, err := sizeQuery(r)
+	if err != nil {
+		return nil, err
+	}
+	if size != 0 {
+		req.opts.Size = size
+	}
+
+	level, err := qrcode.ParseLevel(query.Get("level"))
+	if err != nil {
+		return nil, err
+	}
+	req.opts.Level = level
+
+	if v := query.Get("fg"); v != "" {
+		if req.opts.Foreground, err = qrcode.ParseColor(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := query.Get("bg"); v != "" {
+		if req.opts.Background, err = qrcode.ParseColor(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := svgOptions(r, &req.opts); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// etag identifies the rendered output. It is derived from the normalised
+// parameters rather than the raw query, so equivalent requests share a tag.
+func (req *renderRequest) etag() string {
+	return renderKey(req.format, req.data, req.opts, 0)
+}
+
+// renderKey hashes everything that determines a rendered image. It serves as
+// both the ETag and the image cache key. Logos are identified by ID, which is
+// safe because uploaded logos are never modified.
+func renderKey(format, content string, opts qrcode.Options, logoID int64) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\x00%s\x00%d\x00%s\x00%d\x00%d\x00%s\x00%s\x00%s\x00%d\x00%d\x00%t",
+		content, format, opts.Size, opts.Level, opts.ModuleSize, opts.QuietZone,
+		qrcode.FormatColor(opts.Foreground), qrcode.FormatColor(opts.Background),
+		opts.Style, logoID, opts.LogoPercent, opts.SwissQRBill)
+	return `"` + hex.EncodeToString(sum.Sum(nil))[:32] + `"`
+}
+
+// renderCached renders content in format with g, reusing a previous render
+// with the same key when the cache still holds one.
+func (h *Handler) renderCached(g *qrcode.Generator, key, format, content string, opts qrcode.Options) ([]byte, error) {
+	if image, ok := h.cache.Get(key); ok {
+		return image, nil
+	}
+
+	image, err := render(g, format, content, opts)
+	if err != nil {
+		return nil, err
+	}
+	h.cache.Put(key, image)
+	return image, nil
+}
+
+func render(g *qrcode.Generator, format, content string, opts qrcode.Options) ([]byte, error) {
+	switch format {
+	case "svg":
+		return g.GenerateSVG(content, opts)
+	case "pdf":
+		return g.GeneratePDF(content, opts)
+	}
+	return g.GeneratePNG(content, opts)
+}
+
+// secretContent reports whether content is an otpauth:// URI, whose secret
+// must not be kept in the render cache or by HTTP caches.
+func secretContent(content string) bool {
+	return len(content) >= len("otpauth:") && strings.EqualFold(content[:len("otpauth:")], "otpauth:")
+}
+
+// handleRender renders the query without storing anything. Renders are not
+// verified even with VERIFY_CODES on: there is no record for the check to
+// protect, and a decode per request would let anyone tie up the CPU.
+func (h *Handler) handleRender(w http.ResponseWriter, r *http.Request) {
+	req, err := parseRenderRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := secretContent(req.data)
+	etag := req.etag()
+	if !secret && matchesETag(r.Header.Get("If-None-Match"), etag) {
+		setRenderCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var image []byte
+	generator := h.generator.Unverified()
+	if secret {
+		image, err = render(generator, req.format, req.data, req.opts)
+	} else {
+		// Kept apart from stored codes' renders, which are verified.
+		image, err = h.renderCached(generator, "render:"+etag, req.format, req.data, req.opts)
+	}
+	if err != nil {
+		if qrcode.IsOptionError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error rendering QR code: %v", err)
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+
+	if secret {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		setRenderCacheHeaders(w, etag)
+	}
+	w.Header().Set("Content-Type", contentTypes[req.format])
+	if _, err := w.Write(image); err != nil {
+		log.Printf("Error writing QR image: %v", err)
+	}
+}
+
+// setRenderCacheHeaders marks a render as cacheable for a day. The output is
+// fully determined by the query, so shared caches may keep it.
+func setRenderCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(renderCacheMaxAge)+", immutable")
+}
+
+// matchesETag reports whether an If-None-Match header lists etag.
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(candidate), "W/"))
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
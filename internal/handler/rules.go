@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+// Rule set limits.
+const (
+	maxRules      = 20
+	maxSplits     = 10
+	maxRuleName   = 64
+	maxSplitTotal = 10000
+)
+
+// defaultRule is the name rule hits are reported under when no rule matched
+// and a scan went to the link's own target.
+const defaultRule = "default"
+
+// Platforms that rules can match, as told by platformOf.
+var rulePlatforms = []string{"ios", "android", "windows", "macos", "linux", "other"}
+
+// ruleDays are the weekday names rules use, indexed by time.Weekday.
+var ruleDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// languageTag matches the language ranges rules accept, such as de or pt-br.
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// redirectRule sends scans of a dynamic code that match all of its conditions
+// to Target, or to one of Split picked at random by weight. Conditions left
+// empty match every scan. Rules are tried in order and the first match wins;
+// scans no rule matches go to the link's target.
+type redirectRule struct {
+	Name string `json:"name,omitempty"`
+	// Platforms are operating systems from rulePlatforms.
+	Platforms []string `json:"platforms,omitempty"`
+	// Languages match the scanner's most preferred Accept-Language entry;
+	// de matches de-AT as well, while de-at matches only de-AT.
+	Languages []string `json:"languages,omitempty"`
+	// Days, From and Until restrict the rule to weekdays and a daily time
+	// window, given as HH:MM in TimeZone (UTC by default). A window whose
+	// end is before its start runs past midnight.
+	Days     []string      `json:"days,omitempty"`
+	From     string        `json:"from,omitempty"`
+	Until    string        `json:"until,omitempty"`
+	TimeZone string        `json:"time_zone,omitempty"`
+	Target   string        `json:"target,omitempty"`
+	Split    []splitTarget `json:"split,omitempty"`
+}
+
+// splitTarget is one arm of a weighted split, such as a landing page variant
+// in an A/B test.
+type splitTarget struct {
+	Name   string `json:"name,omitempty"`
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// checkRules validates a rule set and fills in default names: "rule N" for
+// rules and a, b, ... for split arms. Names identify rules in hit counts, so
+// they must be unique.
+func checkRules(rules []redirectRule) ([]redirectRule, error) {
+	if len(rules) > maxRules {
+		return nil, badRequest("at most %d rules are allowed", maxRules)
+	}
+	names := make(map[string]bool)
+	checked := make([]redirectRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name = strings.TrimSpace(rule.Name); rule.Name == "" {
+			rule.Name = "rule " + strconv.Itoa(i+1)
+		}
+		if len(rule.Name) > maxRuleName || strings.Contains(rule.Name, "/") {
+			return nil, badRequest("rule names must be at most %d bytes and not contain /", maxRuleName)
+		}
+		if rule.Name == defaultRule || names[rule.Name] {
+			return nil, badRequest("rule name %q is reserved or already used", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.check(); err != nil {
+			return nil, badRequest("%s: %v", rule.Name, err)
+		}
+		checked = append(checked, rule)
+	}
+	return checked, nil
+}
+
+// check validates the conditions and targets of one rule, normalising their
+// case.
+func (rule *redirectRule) check() error {
+	for i, p := range rule.Platforms {
+		rule.Platforms[i] = strings.ToLower(strings.TrimSpace(p))
+		if !slices.Contains(rulePlatforms, rule.Platforms[i]) {
+			return badRequest("unknown platform %q; use one of %s", p, strings.Join(rulePlatforms, ", "))
+		}
+	}
+	for i, lang := range rule.Languages {
+		rule.Languages[i] = strings.ToLower(strings.TrimSpace(lang))
+		if !languageTag.MatchString(rule.Languages[i]) {
+			return badRequest("invalid language %q", lang)
+		}
+	}
+	for i, day := range rule.Days {
+		rule.Days[i] = strings.ToLower(strings.TrimSpace(day))
+		if !slices.Contains(ruleDays, rule.Days[i]) {
+			return badRequest("unknown day %q; use one of %s", day, strings.Join(ruleDays, ", "))
+		}
+	}
+
+	if (rule.From == "") != (rule.Until == "") {
+		return badRequest("from and until must be given together")
+	}
+	if rule.From != "" {
+		from, err := parseClock(rule.From)
+		if err != nil {
+			return err
+		}
+		until, err := parseClock(rule.Until)
+		if err != nil {
+			return err
+		}
+		if from == until {
+			return badRequest("from and until must differ")
+		}
+	}
+	if rule.TimeZone != "" {
+		if _, err := time.LoadLocation(rule.TimeZone); err != nil {
+			return badRequest("unknown time zone %q", rule.TimeZone)
+		}
+	}
+
+	switch {
+	case rule.Target != "" && len(rule.Split) > 0:
+		return badRequest("give either a target or a split, not both")
+	case rule.Target != "":
+		return checkRedirectURL("rule target", rule.Target)
+	case len(rule.Split) < 2 || len(rule.Split) > maxSplits:
+		return badRequest("a rule needs a target or a split of 2 to %d targets", maxSplits)
+	}
+	total := 0
+	names := make(map[string]bool)
+	for i := range rule.Split {
+		arm := &rule.Split[i]
+		if arm.Name = strings.TrimSpace(arm.Name); arm.Name == "" {
+			arm.Name = string(rune('a' + i))
+		}
+		if len(arm.Name) > maxRuleName || strings.Contains(arm.Name, "/") || names[arm.Name] {
+			return badRequest("split names must be unique, at most %d bytes and not contain /", maxRuleName)
+		}
+		names[arm.Name] = true
+		if arm.Weight < 1 {
+			return badRequest("split weights must be positive")
+		}
+		total += arm.Weight
+		if err := checkRedirectURL("split target", arm.Target); err != nil {
+			return err
+		}
+	}
+	if total > maxSplitTotal {
+		return badRequest("split weights must add up to at most %d", maxSplitTotal)
+	}
+	return nil
+}
+
+// parseClock parses an HH:MM time of day into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, badRequest("invalid time of day %q; use HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// matches reports whether a scan from platform with the preferred language
+// at now meets the conditions of rule. The rule must have been checked.
+func (rule *redirectRule) matches(platform, language string, now time.Time) bool {
+	if len(rule.Platforms) > 0 && !slices.Contains(rule.Platforms, platform) {
+		return false
+	}
+	if len(rule.Languages) > 0 && !slices.ContainsFunc(rule.Languages, func(lang string) bool {
+		return language == lang || strings.HasPrefix(language, lang+"-")
+	}) {
+		return false
+	}
+
+	if rule.TimeZone != "" {
+		loc, err := time.LoadLocation(rule.TimeZone)
+		if err != nil {
+			return false
+		}
+		now = now.In(loc)
+	} else {
+		now = now.UTC()
+	}
+	if len(rule.Days) > 0 && !slices.Contains(rule.Days, ruleDays[now.Weekday()]) {
+		return false
+	}
+	if rule.From != "" {
+		from, _ := parseClock(rule.From)
+		until, _ := parseClock(rule.Until)
+		minute := now.Hour()*60 + now.Minute()
+		if from < until {
+			return from <= minute && minute < until
+		}
+		return minute >= from || minute < until
+	}
+	return true
+}
+
+// pick returns the target of a matching rule and the name its hit is
+// counted under.
+func (rule *redirectRule) pick() (target, hit string) {
+	if rule.Target != "" {
+		return rule.Target, rule.Name
+	}
+	total := 0
+	for _, arm := range rule.Split {
+		total += arm.Weight
+	}
+	n := rand.IntN(total)
+	for _, arm := range rule.Split {
+		if n < arm.Weight {
+			return arm.Target, rule.Name + "/" + arm.Name
+		}
+		n -= arm.Weight
+	}
+	last := rule.Split[len(rule.Split)-1]
+	return last.Target, rule.Name + "/" + last.Name
+}
+
+// platformOf tells the operating system from a User-Agent header. iPads that
+// ask for desktop sites claim to be Macs and are taken at their word.
+func platformOf(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case strings.Contains(lower, "iphone") || strings.Contains(lower, "ipad") || strings.Contains(lower, "ipod"):
+		return "ios"
+	case strings.Contains(lower, "android"):
+		return "android"
+	case strings.Contains(lower, "windows"):
+		return "windows"
+	case strings.Contains(lower, "macintosh") || strings.Contains(lower, "mac os x"):
+		return "macos"
+	case strings.Contains(lower, "linux") || strings.Contains(lower, "x11"):
+		return "linux"
+	}
+	return "other"
+}
+
+// preferredLanguage returns the lower-cased language range with the highest
+// quality in an Accept-Language header, the first of equals, or "".
+func preferredLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, entry := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(entry, ";")
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// encodeRules returns the stored form of a checked rule set.
+func encodeRules(rules []redirectRule) (string, error) {
+	if len(rules) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode rules: %w", err)
+	}
+	return string(data), nil
+}
+
+// linkRules returns the rules of link. Rules that cannot be read are logged
+// and ignored, so scans still reach the link's target.
+func linkRules(link *storage.Link) []redirectRule {
+	if link.Rules == "" {
+		return nil
+	}
+	var rules []redirectRule
+	if err := json.Unmarshal([]byte(link.Rules), &rules); err != nil {
+		log.Printf("Error reading rules of code %d: %v", link.CodeID, err)
+		return nil
+	}
+	return rules
+}
+
+// chooseTarget returns where a scan of an active link goes and the name of
+// the rule that decided it, or defaultRule.
+func chooseTarget(r *http.Request, link *storage.Link, now time.Time) (target, hit string) {
+	rules := linkRules(link)
+	if len(rules) == 0 {
+		return link.Target, defaultRule
+	}
+	platform := platformOf(r.UserAgent())
+	language := preferredLanguage(r.Header.Get("Accept-Language"))
+	for i := range rules {
+		if rules[i].matches(platform, language, now) {
+			return rules[i].pick()
+		}
+	}
+	return link.Target, defaultRule
+}
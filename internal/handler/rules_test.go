@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+)
+
+func TestPlatformAndLanguage(t *testing.T) {
+	for ua, want := range map[string]string{
+		iPhoneUA:  "ios",
+		androidUA: "android",
+		desktopUA: "windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 Version/17.4 Safari/605.1.15": "macos",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0":                         "linux",
+		"": "other",
+	} {
+		if got := platformOf(ua); got != want {
+			t.Errorf("platformOf(%q) = %s, want %s", ua, got, want)
+		}
+	}
+
+	for header, want := range map[string]string{
+		"de-AT,de;q=0.9,en;q=0.8": "de-at",
+		"en;q=0.5, fr":            "fr",
+		"*, es;q=0.1":             "es",
+		"it;q=0":                  "",
+		"":                        "",
+	} {
+		if got := preferredLanguage(header); got != want {
+			t.Errorf("preferredLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rules, err := checkRules([]redirectRule{
+		{Languages: []string{"DE"}, Target: "https://example.com/de"},
+		{Days: []string{"Sat", "sun"}, Target: "https://example.com/weekend"},
+		{From: "22:00", Until: "06:00", TimeZone: "Europe/Berlin", Target: "https://example.com/night"},
+	})
+	if err != nil {
+		t.Fatalf("checkRules failed: %v", err)
+	}
+	if rules[0].Name != "rule 1" || rules[0].Languages[0] != "de" || rules[1].Days[0] != "sat" {
+		t.Errorf("Expected default names and lower-cased conditions, got %+v", rules[:2])
+	}
+
+	monday := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule     int
+		language string
+		now      time.Time
+		want     bool
+	}{
+		{0, "de", monday, true},
+		{0, "de-at", monday, true},
+		{0, "den", monday, false},
+		{0, "", monday, false},
+		{1, "", monday, false},
+		{1, "", monday.AddDate(0, 0, 5), true},
+		{2, "", monday, false},
+		{2, "", time.Date(2026, 6, 1, 21, 30, 0, 0, time.UTC), true}, // 23:30 in Berlin
+		{2, "", time.Date(2026, 6, 1, 3, 59, 0, 0, time.UTC), true},  // 05:59 in Berlin
+		{2, "", time.Date(2026, 6, 1, 4, 0, 0, 0, time.UTC), false},  // 06:00 in Berlin
+	}
+	for _, tt := range tests {
+		if got := rules[tt.rule].matches("ios", tt.language, tt.now); got != tt.want {
+			t.Errorf("rule %d with %q at %s: got %v, want %v", tt.rule, tt.language, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestRedirectRules(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true,"rules":[
+		{"name":"ios","platforms":["ios"],"target":"https://apps.example.com/app"},
+		{"name":"android","platforms":["android"],"target":"https://play.example.com/app"},
+		{"name":"landing","languages":["en"],"split":[{"target":"https://example.com/a","weight":1},{"target":"https://example.com/b","weight":1}]}
+	]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+	if len(code.Rules) != 3 || code.Rules[2].Split[1].Name != "b" {
+		t.Fatalf("Expected the rules with split names, got %+v", code.Rules)
+	}
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	scan := func(method, ua, language string) string {
+		req := httptest.NewRequest(method, "/r/"+code.Slug, nil)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Accept-Language", language)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("Expected status 302, got %d", w.Code)
+		}
+		return w.Header().Get("Location")
+	}
+
+	if got := scan(http.MethodGet, iPhoneUA, "en-US"); got != "https://apps.example.com/app" {
+		t.Errorf("Expected iOS to go to the App Store, got %q", got)
+	}
+	if got := scan(http.MethodGet, androidUA, "en-US"); got != "https://play.example.com/app" {
+		t.Errorf("Expected Android to go to Play, got %q", got)
+	}
+	if got := scan(http.MethodGet, desktopUA, "fr-FR"); got != "https://example.com" {
+		t.Errorf("Expected other scans to go to the target, got %q", got)
+	}
+	seen := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		seen[scan(http.MethodGet, desktopUA, "en-GB,en;q=0.9")]++
+	}
+	if len(seen) != 2 || seen["https://example.com/a"] == 0 || seen["https://example.com/b"] == 0 {
+		t.Errorf("Expected the split to use both targets, got %v", seen)
+	}
+	// HEAD requests are not counted
+	scan(http.MethodHead, iPhoneUA, "")
+
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes/"+strconv.FormatInt(code.ID, 10)+"/scans", "")
+	var stats scanStats
+	decodeAPIResponse(t, w, &stats)
+	if stats.Rules["ios"] != 1 || stats.Rules["android"] != 1 || stats.Rules[defaultRule] != 1 ||
+		stats.Rules["landing/a"]+stats.Rules["landing/b"] != 100 {
+		t.Errorf("Unexpected rule hits %v", stats.Rules)
+	}
+
+	// Rules can be replaced and removed
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(code.ID, 10)
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"rules":[{"platforms":["android"],"target":"https://example.com/android"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scan(http.MethodGet, androidUA, ""); got != "https://example.com/android" {
+		t.Errorf("Expected the new rule to apply, got %q", got)
+	}
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"rules":[]}`)
+	var cleared apiCode
+	decodeAPIResponse(t, w, &cleared)
+	if len(cleared.Rules) != 0 {
+		t.Errorf("Expected no rules, got %+v", cleared.Rules)
+	}
+	if got := scan(http.MethodGet, iPhoneUA, ""); got != "https://example.com" {
+		t.Errorf("Expected scans to go to the target without rules, got %q", got)
+	}
+
+	for _, body := range []string{
+		`{"content":"https://example.com","dynamic":true,"rules":[{"platforms":["symbian"],"target":"https://example.com"}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"languages":["english!"],"target":"https://example.com"}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"from":"09:00","target":"https://example.com"}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"from":"09:00","until":"17:00","time_zone":"Mars/Olympus","target":"https://example.com"}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"target":"javascript:alert(1)"}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"split":[{"target":"https://example.com/a","weight":1}]}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"split":[{"target":"https://example.com/a","weight":1},{"target":"https://example.com/b","weight":0}]}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"name":"x","target":"https://example.com"},{"name":"x","target":"https://example.com"}]}`,
+		`{"content":"https://example.com","dynamic":true,"rules":[{"name":"default","target":"https://example.com"}]}`,
+		`{"content":"https://example.com","rules":[{"target":"https://example.com"}]}`,
+	} {
+		w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
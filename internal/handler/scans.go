@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+// Scan statistics cover the last statsDefaultDays days unless ?days= asks for
+// up to statsMaxDays.
+const (
+	statsDefaultDays = 30
+	statsMaxDays     = 366
+)
+
+// Coarse device classes recorded for scans.
+const (
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+	deviceDesktop = "desktop"
+	deviceBot     = "bot"
+	deviceUnknown = "unknown"
+)
+
+// botMarkers identify crawlers, link previews and command-line clients, which
+// fetch links without a person scanning anything.
+var botMarkers = []string{
+	"bot", "crawler", "spider", "preview", "facebookexternalhit",
+	"curl/", "wget/", "python-requests", "go-http-client",
+}
+
+// clientMarkers map user-agent substrings to client classes. Order matters:
+// most browsers also claim to be Safari, and Edge and Opera to be Chrome.
+var clientMarkers = []struct{ marker, client string }{
+	{"fban", "in-app"}, {"fbav", "in-app"}, {"instagram", "in-app"},
+	{"edg", "edge"},
+	{"opr/", "opera"}, {"opera", "opera"},
+	{"samsungbrowser", "samsung"},
+	{"crios", "chrome"}, {"chrome/", "chrome"},
+	{"fxios", "firefox"}, {"firefox/", "firefox"},
+	{"safari/", "safari"},
+}
+
+// classifyUserAgent reduces a User-Agent header to a client class, such as
+// chrome or in-app, and a device class, so the agent itself need not be kept.
+func classifyUserAgent(ua string) (client, device string) {
+	if ua == "" {
+		return deviceUnknown, deviceUnknown
+	}
+	lower := strings.ToLower(ua)
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return deviceBot, deviceBot
+		}
+	}
+
+	switch {
+	case strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") ||
+		(strings.Contains(lower, "android") && !strings.Contains(lower, "mobile")):
+		device = deviceTablet
+	case strings.Contains(lower, "mobi") || strings.Contains(lower, "iphone") || strings.Contains(lower, "android"):
+		device = deviceMobile
+	default:
+		device = deviceDesktop
+	}
+
+	for _, m := range clientMarkers {
+		if strings.Contains(lower, m.marker) {
+			return m.client, device
+		}
+	}
+	return "other", device
+}
+
+// referrerHost returns the host of the Referer header, dropping the path and
+// query, which may identify the visitor.
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// SetIPHashKey enables recording a keyed hash of each scanner's IP address,
+// which tells repeat scans apart without storing the address. Changing the
+// key makes earlier hashes unmatchable.
+func (h *Handler) SetIPHashKey(key string) {
+	h.ipHashKey = []byte(key)
+}
+
+// ipHash returns the keyed hash of the client address, or "" when IP hashing
+// is off. Behind a trusted proxy the forwarded address is used.
+func (h *Handler) ipHash(r *http.Request) string {
+	if len(h.ipHashKey) == 0 {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, h.ipHashKey)
+	mac.Write([]byte(h.clientIP(r)))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// recordScan stores a hit on the link of a dynamic code. Failures are logged
+// rather than returned, so they never hold up the redirect.
+func (h *Handler) recordScan(r *http.Request, link *storage.Link) {
+	client, device := classifyUserAgent(r.UserAgent())
+	scan := &storage.Scan{
+		CodeID:   link.CodeID,
+		Client:   client,
+		Device:   device,
+		Referrer: referrerHost(r),
+		IPHash:   h.ipHash(r),
+	}
+	if err := h.store.RecordScan(scan); err != nil {
+		log.Printf("Error recording scan: %v", err)
+	}
+}
+
+// scanStats is the JSON form of a dynamic code's scans over a period.
+type scanStats struct {
+	Days      int            `json:"days"`
+	Total     int            `json:"total"`
+	Daily     []dailyScans   `json:"daily"`
+	Clients   map[string]int `json:"clients"`
+	Devices   map[string]int `json:"devices"`
+	Referrers map[string]int `json:"referrers"`
+	// Rules counts redirects by the rule that decided them, for codes
+	// that have had rules.
+	Rules map[string]int `json:"rules,omitempty"`
+}
+
+type dailyScans struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// statsDays parses the ?days= period of scan statistics.
+func statsDays(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("days")
+	if v == "" {
+		return statsDefaultDays, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > statsMaxDays {
+		return 0, badRequest("days must be between 1 and %d", statsMaxDays)
+	}
+	return days, nil
+}
+
+// statsSince returns the start of a period of days UTC days ending today.
+func statsSince(days int) time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+}
+
+// dailySeries returns one entry for each of the last days UTC days, ending
+// today, with zero for days without scans.
+func (h *Handler) dailySeries(codeID int64, days int) ([]dailyScans, error) {
+	since := statsSince(days)
+	counts, err := h.store.DailyScans(codeID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]dailyScans, days)
+	for i := range series {
+		series[i].Date = since.AddDate(0, 0, i).Format(time.DateOnly)
+	}
+	for _, c := range counts {
+		if i := int(c.Day.Sub(since).Hours() / 24); i >= 0 && i < days {
+			series[i].Count = c.Count
+		}
+	}
+	return series, nil
+}
+
+// scanCode loads the dynamic code named by the {id} path value for scan
+// statistics. Errors are returned as requestErrors where the caller is at
+// fault.
+func (h *Handler) scanCode(r *http.Request) (*storage.Link, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, badRequest("Invalid ID")
+	}
+	code, err := h.store.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		return nil, &requestError{status: http.StatusNotFound, message: "QR code not found"}
+	}
+	link, err := h.store.GetLinkByCode(id)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, badRequest("only dynamic codes record scans")
+	}
+	return link, nil
+}
+
+func (h *Handler) handleAPIScans(w http.ResponseWriter, r *http.Request) {
+	link, err := h.scanCode(r)
+	if err != nil {
+		status, message := errorStatus(err, "Failed to get scans")
+		writeJSONError(w, status, message)
+		return
+	}
+	days, err := statsDays(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats := scanStats{Days: days}
+	stats.Daily, err = h.dailySeries(link.CodeID, days)
+	if err != nil {
+		log.Printf("Error counting scans: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get scans")
+		return
+	}
+	for _, day := range stats.Daily {
+		stats.Total += day.Count
+	}
+
+	since := statsSince(days)
+	for _, b := range []struct {
+		dim    storage.ScanDimension
+		counts *map[string]int
+	}{
+		{storage.ScanByClient, &stats.Clients},
+		{storage.ScanByDevice, &stats.Devices},
+		{storage.ScanByReferrer, &stats.Referrers},
+	} {
+		if *b.counts, err = h.store.ScanCounts(link.CodeID, since, b.dim); err != nil {
+			log.Printf("Error counting scans: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to get scans")
+			return
+		}
+	}
+	// Scans without a referrer are the norm for printed codes.
+	delete(stats.Referrers, "")
+	if stats.Rules, err = h.store.RuleHits(link.CodeID, since); err != nil {
+		log.Printf("Error counting rule hits: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get scans")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleScansCSV exports a dynamic code's daily scan counts as CSV.
+func (h *Handler) handleScansCSV(w http.ResponseWriter, r *http.Request) {
+	link, err := h.scanCode(r)
+	if err != nil {
+		status, message := errorStatus(err, "Failed to export scans")
+		http.Error(w, message, status)
+		return
+	}
+	days, err := statsDays(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := h.dailySeries(link.CodeID, days)
+	if err != nil {
+		log.Printf("Error counting scans: %v", err)
+		http.Error(w, "Failed to export scans", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="qr-%d-scans.csv"`, link.CodeID))
+	out := csv.NewWriter(w)
+	records := [][]string{{"date", "scans"}}
+	for _, day := range series {
+		records = append(records, []string{day.Date, strconv.Itoa(day.Count)})
+	}
+	if err := out.WriteAll(records); err != nil {
+		log.Printf("Error writing CSV: %v", err)
+	}
+}
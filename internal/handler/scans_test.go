@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		ua             string
+		client, device string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", "safari", "mobile"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.71 Mobile/15E148 Safari/604.1", "chrome", "mobile"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36", "chrome", "mobile"},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/115.0.0.0 Safari/537.36", "samsung", "tablet"},
+		{"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", "safari", "tablet"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.67", "edge", "desktop"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", "firefox", "desktop"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Instagram 329.0.0.0", "in-app", "mobile"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "bot", "bot"},
+		{"curl/8.5.0", "bot", "bot"},
+		{"", "unknown", "unknown"},
+		{"SomeScanner/1.0", "other", "desktop"},
+	}
+	for _, tt := range tests {
+		client, device := classifyUserAgent(tt.ua)
+		if client != tt.client || device != tt.device {
+			t.Errorf("classifyUserAgent(%q) = %s, %s; want %s, %s", tt.ua, client, device, tt.client, tt.device)
+		}
+	}
+}
+
+func TestScanAnalytics(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+	h.SetIPHashKey("secret")
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true}`)
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	scan := func(method, ua, referrer string) {
+		req := httptest.NewRequest(method, "/r/"+code.Slug, nil)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Referer", referrer)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("Expected status 302, got %d", w.Code)
+		}
+	}
+	scan(http.MethodGet, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) Version/17.4 Mobile/15E148 Safari/604.1", "")
+	scan(http.MethodGet, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) Version/17.4 Mobile/15E148 Safari/604.1", "https://news.example.org/post/1?utm_source=x")
+	scan(http.MethodGet, "curl/8.5.0", "")
+	scan(http.MethodHead, "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", "")
+
+	base := "/api/v1/codes/" + strconv.FormatInt(code.ID, 10) + "/scans"
+	w = apiRequest(t, h, http.MethodGet, base+"?days=7", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var stats scanStats
+	decodeAPIResponse(t, w, &stats)
+	today := time.Now().UTC().Format(time.DateOnly)
+	if stats.Days != 7 || stats.Total != 3 || len(stats.Daily) != 7 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if last := stats.Daily[6]; last.Date != today || last.Count != 3 || stats.Daily[0].Count != 0 {
+		t.Errorf("Expected today's 3 scans last, got %+v", stats.Daily)
+	}
+	if stats.Devices["mobile"] != 2 || stats.Devices["bot"] != 1 || stats.Clients["safari"] != 2 {
+		t.Errorf("Unexpected breakdown %v %v", stats.Devices, stats.Clients)
+	}
+	if len(stats.Referrers) != 1 || stats.Referrers["news.example.org"] != 1 {
+		t.Errorf("Expected only the referrer host, got %v", stats.Referrers)
+	}
+
+	// CSV export of daily counts
+	w = apiRequest(t, h, http.MethodGet, "/qr/"+strconv.FormatInt(code.ID, 10)+"/scans.csv?days=2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Expected Content-Type text/csv, got %s", ct)
+	}
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	if want := "date,scans\n" + yesterday + ",0\n" + today + ",3\n"; w.Body.String() != want {
+		t.Errorf("Expected CSV %q, got %q", want, w.Body.String())
+	}
+
+	w = apiRequest(t, h, http.MethodGet, base+"?days=0", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for days=0, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes/999/scans", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing code, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"static"}`)
+	var static apiCode
+	decodeAPIResponse(t, w, &static)
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes/"+strconv.FormatInt(static.ID, 10)+"/scans", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a static code, got %d", w.Code)
+	}
+}
+
+func TestIPHash(t *testing.T) {
+	h := &Handler{}
+	req := httptest.NewRequest(http.MethodGet, "/r/x", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if got := h.ipHash(req); got != "" {
+		t.Errorf("Expected no hash without a key, got %q", got)
+	}
+
+	h.SetIPHashKey("secret")
+	hash := h.ipHash(req)
+	if len(hash) != 32 || strings.Contains(hash, "192.0.2.1") {
+		t.Errorf("Unexpected hash %q", hash)
+	}
+	req.RemoteAddr = "192.0.2.1:5678"
+	if h.ipHash(req) != hash {
+		t.Error("Expected the port to be ignored")
+	}
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if h.ipHash(req) != hash {
+		t.Error("Expected X-Forwarded-For to be ignored without trusted proxies")
+	}
+	if got := h.requestScheme(req); got != "http" {
+		t.Errorf("Expected X-Forwarded-Proto to be ignored without trusted proxies, got %q", got)
+	}
+
+	if err := h.SetTrustedProxies("10.0.0.1, 192.0.2.0/24"); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	forwarded := h.ipHash(req)
+	if forwarded == hash {
+		t.Error("Expected the forwarded address to be hashed")
+	}
+	if got := h.requestScheme(req); got != "https" {
+		t.Errorf("Expected X-Forwarded-Proto from a trusted proxy, got %q", got)
+	}
+	// Only the hops appended by trusted proxies count; a client can put
+	// anything in front of them.
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.1")
+	if h.ipHash(req) != forwarded {
+		t.Error("Expected the address before the trusted hops to be hashed")
+	}
+
+	if err := h.SetTrustedProxies("proxy.local"); err == nil {
+		t.Error("Expected an error for a proxy that is not an address")
+	}
+}
+
+func TestScansCountRedirectsOnly(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	get := func(slug string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/r/"+slug, nil))
+		return w.Code
+	}
+	scans := func(id int64) int {
+		w := apiRequest(t, h, http.MethodGet, "/api/v1/codes/"+strconv.FormatInt(id, 10)+"/scans", "")
+		var stats scanStats
+		decodeAPIResponse(t, w, &stats)
+		return stats.Total
+	}
+
+	// The passphrase form is not a scan, nor does it use up max_scans
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true,"passphrase":"open sesame","max_scans":1}`)
+	var locked apiCode
+	decodeAPIResponse(t, w, &locked)
+	for i := 0; i < 2; i++ {
+		if code := get(locked.Slug); code != http.StatusOK {
+			t.Fatalf("Expected the passphrase form with 200, got %d", code)
+		}
+	}
+	if n := scans(locked.ID); n != 0 {
+		t.Errorf("Expected the passphrase form not to count, got %d scans", n)
+	}
+	if w := unlock(h, locked.Slug, "open sesame"); w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the unlock to redirect with 303, got %d", w.Code)
+	}
+	if n := scans(locked.ID); n != 1 {
+		t.Errorf("Expected the unlocked redirect to count once, got %d scans", n)
+	}
+
+	// Notices of inactive codes are not scans
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"https://example.com","dynamic":true,"expires_at":"2020-01-01T00:00:00Z"}`)
+	var expired apiCode
+	decodeAPIResponse(t, w, &expired)
+	if code := get(expired.Slug); code != http.StatusGone {
+		t.Fatalf("Expected status 410, got %d", code)
+	}
+	if n := scans(expired.ID); n != 0 {
+		t.Errorf("Expected the expiry notice not to count, got %d scans", n)
+	}
+}
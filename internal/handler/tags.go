@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+// Bounds on how codes are organised.
+const (
+	maxTags                = 20
+	maxTagChars            = 32
+	maxCollectionNameChars = 64
+)
+
+// checkTags validates the tags of a code and returns them lower-cased and
+// without blanks or repeats, in their original order.
+func checkTags(tags []string) ([]string, error) {
+	var checked []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(checked, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagChars {
+			return nil, badRequest("tags must be at most %d characters", maxTagChars)
+		}
+		if strings.ContainsRune(tag, ',') || strings.ContainsFunc(tag, unicode.IsControl) {
+			return nil, badRequest("tag %q must not contain commas or control characters", tag)
+		}
+		checked = append(checked, tag)
+	}
+	if len(checked) > maxTags {
+		return nil, badRequest("a code can have at most %d tags", maxTags)
+	}
+	return checked, nil
+}
+
+// formTags splits the comma-separated tags form field.
+func formTags(r *http.Request) []string {
+	if v := r.FormValue("tags"); v != "" {
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
+type apiCollection struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Codes     int       `json:"codes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toAPICollection(c *storage.Collection) apiCollection {
+	return apiCollection{ID: c.ID, Name: c.Name, Codes: c.Codes, CreatedAt: c.CreatedAt}
+}
+
+// collectionRequest creates or renames a collection.
+type collectionRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *collectionRequest) name() (string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxCollectionNameChars {
+		return "", badRequest("name must be 1 to %d characters", maxCollectionNameChars)
+	}
+	return name, nil
+}
+
+// handleAPITags lists the tags in use with the number of codes carrying
+// each.
+func (h *Handler) handleAPITags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.store.Tags()
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list tags")
+		return
+	}
+
+	type apiTag struct {
+		Name  string `json:"name"`
+		Codes int    `json:"codes"`
+	}
+	resp := struct {
+		Tags []apiTag `json:"tags"`
+	}{Tags: make([]apiTag, 0, len(tags))}
+	for _, t := range tags {
+		resp.Tags = append(resp.Tags, apiTag{t.Name, t.Codes})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleAPICollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := h.store.ListCollections()
+	if err != nil {
+		log.Printf("Error listing collections: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list collections")
+		return
+	}
+
+	resp := struct {
+		Collections []apiCollection `json:"collections"`
+	}{Collections: make([]apiCollection, 0, len(collections))}
+	for _, c := range collections {
+		resp.Collections = append(resp.Collections, toAPICollection(c))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleAPICreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req collectionRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name, err := req.name()
+	if err != nil {
+		status, message := errorStatus(err, "Failed to create collection")
+		writeJSONError(w, status, message)
+		return
+	}
+
+	collection, err := h.store.CreateCollection(name)
+	if errors.Is(err, storage.ErrCollectionExists) {
+		writeJSONError(w, http.StatusConflict, "a collection named "+strconv.Quote(name)+" already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating collection: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create collection")
+		return
+	}
+	w.Header().Set("Location", "/api/v1/collections/"+strconv.FormatInt(collection.ID, 10))
+	writeJSON(w, http.StatusCreated, toAPICollection(collection))
+}
+
+func (h *Handler) handleAPIRenameCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var req collectionRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name, err := req.name()
+	if err != nil {
+		status, message := errorStatus(err, "Failed to rename collection")
+		writeJSONError(w, status, message)
+		return
+	}
+
+	err = h.store.RenameCollection(id, name)
+	switch {
+	case errors.Is(err, storage.ErrCollectionNotFound):
+		writeJSONError(w, http.StatusNotFound, "Collection not found")
+		return
+	case errors.Is(err, storage.ErrCollectionExists):
+		writeJSONError(w, http.StatusConflict, "a collection named "+strconv.Quote(name)+" already exists")
+		return
+	case err != nil:
+		log.Printf("Error renaming collection: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to rename collection")
+		return
+	}
+
+	collection, err := h.store.GetCollection(id)
+	if err != nil || collection == nil {
+		log.Printf("Error reloading collection: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to rename collection")
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPICollection(collection))
+}
+
+func (h *Handler) handleAPIDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := h.store.DeleteCollection(id); err != nil {
+		if errors.Is(err, storage.ErrCollectionNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Collection not found")
+			return
+		}
+		log.Printf("Error deleting collection: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete collection")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPICollectionCode adds the code {code_id} to the collection {id}
+// on PUT and takes it out on DELETE.
+func (h *Handler) handleAPICollectionCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	codeID, err := strconv.ParseInt(r.PathValue("code_id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid code ID")
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		err = h.store.AddToCollection(id, codeID)
+	} else {
+		err = h.store.RemoveFromCollection(id, codeID)
+	}
+	switch {
+	case errors.Is(err, storage.ErrCollectionNotFound):
+		writeJSONError(w, http.StatusNotFound, "Collection not found")
+		return
+	case errors.Is(err, storage.ErrNotFound) && r.Method == http.MethodPut:
+		writeJSONError(w, http.StatusNotFound, "QR code not found")
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, "QR code is not in this collection")
+		return
+	case err != nil:
+		log.Printf("Error updating collection: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update collection")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+func TestCodeTags(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"a","tags":[" Print ","spring","print",""]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+	if strings.Join(code.Tags, ",") != "print,spring" {
+		t.Errorf("Expected normalised tags, got %q", code.Tags)
+	}
+
+	form := url.Values{"content": {"b"}, "tags": {"print, window"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.handleGenerate(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/tags", "")
+	var tags struct {
+		Tags []struct {
+			Name  string `json:"name"`
+			Codes int    `json:"codes"`
+		} `json:"tags"`
+	}
+	decodeAPIResponse(t, w, &tags)
+	if len(tags.Tags) != 3 || tags.Tags[0].Name != "print" || tags.Tags[0].Codes != 2 {
+		t.Errorf("Unexpected tags %+v", tags.Tags)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes?tag=window", "")
+	var list struct {
+		Codes []apiCode `json:"codes"`
+		Total int       `json:"total"`
+	}
+	decodeAPIResponse(t, w, &list)
+	if list.Total != 1 || list.Codes[0].Content != "b" || len(list.Codes[0].Tags) != 2 {
+		t.Errorf("Expected code b with its tags, got %+v", list.Codes)
+	}
+
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(code.ID, 10)
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"tags":[]}`)
+	var updated apiCode
+	decodeAPIResponse(t, w, &updated)
+	if len(updated.Tags) != 0 {
+		t.Errorf("Expected no tags, got %q", updated.Tags)
+	}
+	if n, _ := h.store.Count(storage.Filter{Tag: "spring"}); n != 0 {
+		t.Errorf("Expected no spring codes, got %d", n)
+	}
+
+	for _, body := range []string{
+		`{"content":"c","tags":["` + strings.Repeat("x", 33) + `"]}`,
+		`{"content":"c","tags":["a\tb"]}`,
+		`{"content":"c","tags":["a,b"]}`,
+		`{"content":"c","tags":["1","2","3","4","5","6","7","8","9","10","11","12","13","14","15","16","17","18","19","20","21"]}`,
+	} {
+		if w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %.60s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"content":"menu"}`)
+	var code apiCode
+	decodeAPIResponse(t, w, &code)
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/collections", `{"name":" Menus "}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var collection apiCollection
+	decodeAPIResponse(t, w, &collection)
+	if collection.ID == 0 || collection.Name != "Menus" {
+		t.Errorf("Unexpected collection %+v", collection)
+	}
+	if w := apiRequest(t, h, http.MethodPost, "/api/v1/collections", `{"name":"Menus"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken name, got %d", w.Code)
+	}
+	if w := apiRequest(t, h, http.MethodPost, "/api/v1/collections", `{"name":""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty name, got %d", w.Code)
+	}
+
+	collectionURL := "/api/v1/collections/" + strconv.FormatInt(collection.ID, 10)
+	codeURL := collectionURL + "/codes/" + strconv.FormatInt(code.ID, 10)
+	if w := apiRequest(t, h, http.MethodPut, codeURL, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := apiRequest(t, h, http.MethodPut, collectionURL+"/codes/9999", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing code, got %d", w.Code)
+	}
+	if w := apiRequest(t, h, http.MethodPut, "/api/v1/collections/9999/codes/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing collection, got %d", w.Code)
+	}
+
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes?collection="+strconv.FormatInt(collection.ID, 10), "")
+	var list struct {
+		Codes []apiCode `json:"codes"`
+	}
+	decodeAPIResponse(t, w, &list)
+	if len(list.Codes) != 1 || len(list.Codes[0].Collections) != 1 || list.Codes[0].Collections[0] != collection.ID {
+		t.Errorf("Expected the code with its collection, got %+v", list.Codes)
+	}
+	if w := apiRequest(t, h, http.MethodGet, "/api/v1/codes?collection=menus", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a bad collection filter, got %d", w.Code)
+	}
+
+	w = apiRequest(t, h, http.MethodPatch, collectionURL, `{"name":"Lunch menus"}`)
+	var renamed apiCollection
+	decodeAPIResponse(t, w, &renamed)
+	if renamed.Name != "Lunch menus" || renamed.Codes != 1 {
+		t.Errorf("Unexpected renamed collection %+v", renamed)
+	}
+
+	if w := apiRequest(t, h, http.MethodDelete, codeURL, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	if w := apiRequest(t, h, http.MethodDelete, codeURL, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a code not in the collection, got %d", w.Code)
+	}
+	if w := apiRequest(t, h, http.MethodDelete, collectionURL, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/collections", "")
+	var collections struct {
+		Collections []apiCollection `json:"collections"`
+	}
+	decodeAPIResponse(t, w, &collections)
+	if len(collections.Collections) != 0 {
+		t.Errorf("Expected no collections, got %+v", collections.Collections)
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ironicbadger/qr-code-generator/internal/payload"
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+const maxPresetNameChars = 64
+
+// apiPreset is the JSON form of a UTM preset, with the tag names URL payloads
+// use.
+type apiPreset struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Source    string    `json:"utm_source,omitempty"`
+	Medium    string    `json:"utm_medium,omitempty"`
+	Campaign  string    `json:"utm_campaign,omitempty"`
+	Term      string    `json:"utm_term,omitempty"`
+	Content   string    `json:"utm_content,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toAPIPreset(p *storage.UTMPreset) apiPreset {
+	return apiPreset{
+		ID:        p.ID,
+		Name:      p.Name,
+		Source:    p.Source,
+		Medium:    p.Medium,
+		Campaign:  p.Campaign,
+		Term:      p.Term,
+		Content:   p.Content,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// preset validates a new preset and returns it in storage form.
+func (p *apiPreset) preset() (*storage.UTMPreset, error) {
+	preset := &storage.UTMPreset{Name: strings.TrimSpace(p.Name)}
+	if preset.Name == "" || utf8.RuneCountInString(preset.Name) > maxPresetNameChars {
+		return nil, badRequest("name must be 1 to %d characters", maxPresetNameChars)
+	}
+	for _, tag := range []struct {
+		name       string
+		value, dst *string
+	}{
+		{"utm_source", &p.Source, &preset.Source},
+		{"utm_medium", &p.Medium, &preset.Medium},
+		{"utm_campaign", &p.Campaign, &preset.Campaign},
+		{"utm_term", &p.Term, &preset.Term},
+		{"utm_content", &p.Content, &preset.Content},
+	} {
+		*tag.dst = strings.TrimSpace(*tag.value)
+		if err := payload.CheckUTMTag(tag.name, *tag.dst); err != nil {
+			return nil, badRequest("%s", err.Error())
+		}
+	}
+	if preset.Source+preset.Medium+preset.Campaign+preset.Term+preset.Content == "" {
+		return nil, badRequest("a preset needs at least one UTM tag")
+	}
+	return preset, nil
+}
+
+func (h *Handler) handleAPIPresets(w http.ResponseWriter, r *http.Request) {
+	presets, err := h.store.ListUTMPresets()
+	if err != nil {
+		log.Printf("Error listing UTM presets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list UTM presets")
+		return
+	}
+
+	resp := struct {
+		Presets []apiPreset `json:"presets"`
+	}{Presets: make([]apiPreset, 0, len(presets))}
+	for _, p := range presets {
+		resp.Presets = append(resp.Presets, toAPIPreset(p))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleAPICreatePreset(w http.ResponseWriter, r *http.Request) {
+	var req apiPreset
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	preset, err := req.preset()
+	if err != nil {
+		status, message := errorStatus(err, "Failed to save UTM preset")
+		writeJSONError(w, status, message)
+		return
+	}
+
+	saved, err := h.store.CreateUTMPreset(preset)
+	if errors.Is(err, storage.ErrPresetExists) {
+		writeJSONError(w, http.StatusConflict, "a preset named "+strconv.Quote(preset.Name)+" already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving UTM preset: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save UTM preset")
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIPreset(saved))
+}
+
+func (h *Handler) handleAPIDeletePreset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := h.store.DeleteUTMPreset(id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "UTM preset not found")
+			return
+		}
+		log.Printf("Error deleting UTM preset: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete UTM preset")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPICampaigns lists the UTM campaigns of URL codes with the number of
+// codes in each, for grouping the history.
+func (h *Handler) handleAPICampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.store.Campaigns()
+	if err != nil {
+		log.Printf("Error listing campaigns: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list campaigns")
+		return
+	}
+
+	type apiCampaign struct {
+		Name  string `json:"name"`
+		Codes int    `json:"codes"`
+	}
+	resp := struct {
+		Campaigns []apiCampaign `json:"campaigns"`
+	}{Campaigns: make([]apiCampaign, 0, len(campaigns))}
+	for _, c := range campaigns {
+		resp.Campaigns = append(resp.Campaigns, apiCampaign{c.Name, c.Codes})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ironicbadger/qr-code-generator/internal/storage"
+)
+
+func TestURLCodes(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	form := url.Values{
+		"payload_type": {"url"},
+		"url":          {"https://example.com/shop?ref=window&utm_source=old"},
+		"utm_medium":   {"print"},
+		"utm_campaign": {"spring"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.handleGenerate(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d: %s", w.Code, w.Body.String())
+	}
+
+	codes, err := h.store.List(storage.Filter{}, 10, 0)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("Expected 1 QR code, got %d (%v)", len(codes), err)
+	}
+	code := codes[0]
+	if want := "https://example.com/shop?ref=window&utm_source=old&utm_medium=print&utm_campaign=spring"; code.Content != want {
+		t.Errorf("Expected content %q, got %q", want, code.Content)
+	}
+	if code.Campaign != "spring" || !strings.Contains(code.PayloadData, `"host":"example.com"`) {
+		t.Errorf("Expected the campaign and parsed components to be stored, got %q %s", code.Campaign, code.PayloadData)
+	}
+
+	for _, body := range []string{
+		`{"payload_type":"url","payload":{"url":"https://example.com/a","utm_campaign":"spring"}}`,
+		`{"payload_type":"url","payload":{"url":"https://example.com/b?utm_campaign=autumn"}}`,
+		`{"content":"https://example.com/plain"}`,
+	} {
+		if w := apiRequest(t, h, http.MethodPost, "/api/v1/codes", body); w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// The history is grouped by campaign
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/campaigns", "")
+	var campaigns struct {
+		Campaigns []struct {
+			Name  string `json:"name"`
+			Codes int    `json:"codes"`
+		} `json:"campaigns"`
+	}
+	decodeAPIResponse(t, w, &campaigns)
+	if len(campaigns.Campaigns) != 2 || campaigns.Campaigns[0].Name != "autumn" || campaigns.Campaigns[1].Codes != 2 {
+		t.Errorf("Unexpected campaigns %+v", campaigns.Campaigns)
+	}
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/codes?campaign=spring", "")
+	var list struct {
+		Total int `json:"total"`
+	}
+	decodeAPIResponse(t, w, &list)
+	if list.Total != 2 {
+		t.Errorf("Expected 2 spring codes, got %d", list.Total)
+	}
+
+	// Editing the tags moves the code to another campaign
+	codeURL := "/api/v1/codes/" + strconv.FormatInt(code.ID, 10)
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"payload_type":"url","payload":{"url":"https://example.com/shop","utm_campaign":"autumn"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if n, _ := h.store.Count(storage.Filter{Campaign: "autumn"}); n != 2 {
+		t.Errorf("Expected 2 autumn codes after the edit, got %d", n)
+	}
+	w = apiRequest(t, h, http.MethodPatch, codeURL, `{"content":"plain text"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if n, _ := h.store.Count(storage.Filter{Campaign: "autumn"}); n != 1 {
+		t.Errorf("Expected the code to leave its campaign as plain text, got %d autumn codes", n)
+	}
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/codes", `{"payload_type":"url","payload":{"url":"example.com"}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a relative URL, got %d", w.Code)
+	}
+}
+
+func TestUTMPresets(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := apiRequest(t, h, http.MethodPost, "/api/v1/utm-presets", `{"name":" Posters ","utm_source":"poster","utm_medium":"print"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var preset apiPreset
+	decodeAPIResponse(t, w, &preset)
+	if preset.ID == 0 || preset.Name != "Posters" || preset.Medium != "print" {
+		t.Errorf("Unexpected preset %+v", preset)
+	}
+
+	w = apiRequest(t, h, http.MethodPost, "/api/v1/utm-presets", `{"name":"Posters","utm_source":"flyer"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken name, got %d", w.Code)
+	}
+	for _, body := range []string{
+		`{"name":"","utm_source":"poster"}`,
+		`{"name":"Empty"}`,
+		`{"name":"Long","utm_term":"` + strings.Repeat("x", 201) + `"}`,
+	} {
+		if w := apiRequest(t, h, http.MethodPost, "/api/v1/utm-presets", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %.60s, got %d", body, w.Code)
+		}
+	}
+
+	w = apiRequest(t, h, http.MethodGet, "/api/v1/utm-presets", "")
+	var list struct {
+		Presets []apiPreset `json:"presets"`
+	}
+	decodeAPIResponse(t, w, &list)
+	if len(list.Presets) != 1 || list.Presets[0].Source != "poster" {
+		t.Errorf("Unexpected presets %+v", list.Presets)
+	}
+
+	presetURL := "/api/v1/utm-presets/" + strconv.FormatInt(preset.ID, 10)
+	if w := apiRequest(t, h, http.MethodDelete, presetURL, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	if w := apiRequest(t, h, http.MethodDelete, presetURL, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", w.Code)
+	}
+}
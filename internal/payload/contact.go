@@ -0,0 +1,235 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Contact formats.
+const (
+	FormatVCard3 = "vcard3"
+	FormatVCard4 = "vcard4"
+	FormatMeCard = "mecard"
+)
+
+// Bounds on repeated contact fields.
+const (
+	maxContactPhones = 5
+	maxContactEmails = 5
+)
+
+// Contact saves a person to the phone's address book, as a vCard or as the
+// more compact MeCard, which yields a noticeably smaller symbol.
+type Contact struct {
+	Format     string   `json:"format,omitempty"`
+	FirstName  string   `json:"first_name,omitempty"`
+	LastName   string   `json:"last_name,omitempty"`
+	Org        string   `json:"org,omitempty"`
+	Phones     []string `json:"phones,omitempty"`
+	Emails     []string `json:"emails,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	Street     string   `json:"street,omitempty"`
+	City       string   `json:"city,omitempty"`
+	Region     string   `json:"region,omitempty"`
+	PostalCode string   `json:"postal_code,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+func (c *Contact) Type() string { return TypeContact }
+
+func (c *Contact) Summary() string { return "Contact: " + c.name() }
+
+// name is the display name: first and last name, or the organisation for a
+// company card.
+func (c *Contact) name() string {
+	if name := strings.TrimSpace(c.FirstName + " " + c.LastName); name != "" {
+		return name
+	}
+	return c.Org
+}
+
+func (c *Contact) hasAddress() bool {
+	return c.Street != "" || c.City != "" || c.Region != "" || c.PostalCode != "" || c.Country != ""
+}
+
+// Encode returns the contact in its chosen format, vCard 3.0 by default.
+func (c *Contact) Encode() (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	switch c.Format {
+	case "", FormatVCard3:
+		return c.vCard("3.0"), nil
+	case FormatVCard4:
+		return c.vCard("4.0"), nil
+	case FormatMeCard:
+		return c.meCard(), nil
+	}
+	return "", fmt.Errorf("format must be %s, %s or %s", FormatVCard3, FormatVCard4, FormatMeCard)
+}
+
+func (c *Contact) validate() error {
+	if c.name() == "" {
+		return errors.New("contact needs a name or organisation")
+	}
+	for _, field := range []string{c.FirstName, c.LastName, c.Org, c.URL, c.Street, c.City, c.Region, c.PostalCode, c.Country} {
+		if strings.ContainsFunc(field, unicode.IsControl) {
+			return errors.New("contact fields must not contain line breaks or control characters")
+		}
+	}
+
+	if len(c.Phones) > maxContactPhones {
+		return fmt.Errorf("at most %d phone numbers", maxContactPhones)
+	}
+	for _, phone := range c.Phones {
+		if !validPhone(phone) {
+			return fmt.Errorf("invalid phone number %q", phone)
+		}
+	}
+
+	if len(c.Emails) > maxContactEmails {
+		return fmt.Errorf("at most %d email addresses", maxContactEmails)
+	}
+	for _, email := range c.Emails {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			return fmt.Errorf("invalid email address %q", email)
+		}
+	}
+
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q: must start with http:// or https://", c.URL)
+		}
+	}
+	return nil
+}
+
+// validPhone accepts digits with an optional leading + and the usual
+// separators, and at least three digits.
+func validPhone(s string) bool {
+	digits := 0
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -.()", r):
+		default:
+			return false
+		}
+	}
+	return digits >= 3
+}
+
+// vCard builds a vCard 3.0 or 4.0. Lines end in CRLF as RFC 2426 and 6350
+// require; text values escape backslash, comma and semicolon. Line breaks
+// are rejected by validate, so they need no escaping here.
+func (c *Contact) vCard(version string) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(s)
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCARD")
+	line("VERSION:" + version)
+	line("N:" + escapeVCard(c.LastName) + ";" + escapeVCard(c.FirstName) + ";;;")
+	line("FN:" + escapeVCard(c.name()))
+	if c.Org != "" {
+		line("ORG:" + escapeVCard(c.Org))
+	}
+	for _, phone := range c.Phones {
+		if version == "4.0" {
+			line("TEL;VALUE=uri:tel:" + strings.Map(telURIRune, phone))
+		} else {
+			line("TEL:" + phone)
+		}
+	}
+	for _, email := range c.Emails {
+		line("EMAIL:" + email)
+	}
+	if c.URL != "" {
+		line("URL:" + c.URL)
+	}
+	if c.hasAddress() {
+		line("ADR:;;" + strings.Join([]string{
+			escapeVCard(c.Street), escapeVCard(c.City), escapeVCard(c.Region),
+			escapeVCard(c.PostalCode), escapeVCard(c.Country),
+		}, ";"))
+	}
+	line("END:VCARD")
+	return b.String()
+}
+
+// meCard builds a MECARD: payload, which has no version line or property
+// parameters and so is much shorter than the equivalent vCard.
+func (c *Contact) meCard() string {
+	var b strings.Builder
+	field := func(name, value string) {
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(escapeField(value))
+		b.WriteString(";")
+	}
+
+	b.WriteString("MECARD:")
+	if c.FirstName != "" || c.LastName != "" {
+		b.WriteString("N:")
+		b.WriteString(escapeField(c.LastName))
+		if c.FirstName != "" {
+			b.WriteString(",")
+			b.WriteString(escapeField(c.FirstName))
+		}
+		b.WriteString(";")
+	} else {
+		field("N", c.Org)
+	}
+	if c.Org != "" && c.name() != c.Org {
+		field("ORG", c.Org)
+	}
+	for _, phone := range c.Phones {
+		field("TEL", phone)
+	}
+	for _, email := range c.Emails {
+		field("EMAIL", email)
+	}
+	if c.URL != "" {
+		field("URL", c.URL)
+	}
+	if c.hasAddress() {
+		// MeCard's ADR separates its parts with commas, PO box first.
+		parts := []string{"", "", c.Street, c.City, c.Region, c.PostalCode, c.Country}
+		for i, part := range parts {
+			parts[i] = escapeField(part)
+		}
+		b.WriteString("ADR:" + strings.Join(parts, ",") + ";")
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
+var vCardEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`,`, `\,`,
+	`;`, `\;`,
+)
+
+func escapeVCard(s string) string {
+	return vCardEscaper.Replace(s)
+}
+
+// telURIRune keeps the characters a tel: URI allows in a global number.
+func telURIRune(r rune) rune {
+	if r == '+' || (r >= '0' && r <= '9') {
+		return r
+	}
+	if r == ' ' || r == '(' || r == ')' {
+		return -1
+	}
+	return '-'
+}
@@ -0,0 +1,229 @@
+package payload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Layouts for event start and end times, as sent by HTML date and
+// datetime-local inputs.
+const (
+	EventDateLayout     = "2006-01-02"
+	EventDateTimeLayout = "2006-01-02T15:04"
+)
+
+// defaultEventDuration is used for timed events without an end.
+const defaultEventDuration = time.Hour
+
+// maxICalLine is the longest content line, in octets, before folding.
+const maxICalLine = 75
+
+// Event adds an entry to the phone's calendar, as an iCalendar VEVENT.
+//
+// Timed events are given in wall-clock time in TimeZone (and EndTimeZone,
+// for events such as flights that end somewhere else) and are written in
+// UTC, which every calendar app reads the same way without needing a
+// VTIMEZONE definition. All-day events are written as plain dates.
+type Event struct {
+	Title       string `json:"title"`
+	Start       string `json:"start"`
+	End         string `json:"end,omitempty"`
+	TimeZone    string `json:"time_zone,omitempty"`
+	EndTimeZone string `json:"end_time_zone,omitempty"`
+	AllDay      bool   `json:"all_day,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (e *Event) Type() string { return TypeEvent }
+
+func (e *Event) Summary() string {
+	day, _, _ := strings.Cut(e.Start, "T")
+	return "Event: " + e.Title + " (" + day + ")"
+}
+
+// Encode returns the event as a VEVENT with folded CRLF lines.
+//
+// The UID and DTSTAMP that RFC 5545 requires are derived from the event
+// rather than the clock, so the same event always encodes to the same code
+// and calendars that import it twice see one event: the UID hashes the
+// fields and the stamp is the start in UTC.
+func (e *Event) Encode() (string, error) {
+	if err := e.validate(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICalLine(s))
+		b.WriteString("\r\n")
+	}
+
+	var start, end time.Time
+	var err error
+	if e.AllDay {
+		start, end, err = e.dates()
+	} else {
+		start, end, err = e.times()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	line("BEGIN:VEVENT")
+	line("UID:" + e.uid())
+	line("DTSTAMP:" + start.UTC().Format("20060102T150405Z"))
+	line("SUMMARY:" + escapeICal(e.Title))
+	if e.AllDay {
+		line("DTSTART;VALUE=DATE:" + start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + end.Format("20060102"))
+	} else {
+		line("DTSTART:" + start.UTC().Format("20060102T150405Z"))
+		line("DTEND:" + end.UTC().Format("20060102T150405Z"))
+	}
+	if e.Location != "" {
+		line("LOCATION:" + escapeICal(e.Location))
+	}
+	if e.Description != "" {
+		line("DESCRIPTION:" + escapeICal(e.Description))
+	}
+	line("END:VEVENT")
+	return b.String(), nil
+}
+
+// uid identifies the event by a hash of its fields.
+func (e *Event) uid() string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\x00%s\x00%s\x00%s\x00%s\x00%t\x00%s\x00%s",
+		e.Title, e.Start, e.End, e.TimeZone, e.EndTimeZone, e.AllDay, e.Location, e.Description)
+	return hex.EncodeToString(sum.Sum(nil))[:32] + "@qr-code-generator"
+}
+
+func (e *Event) validate() error {
+	if strings.TrimSpace(e.Title) == "" {
+		return errors.New("event title is required")
+	}
+	for _, field := range []string{e.Title, e.Location} {
+		if strings.ContainsFunc(field, unicode.IsControl) {
+			return errors.New("event title and location must not contain line breaks or control characters")
+		}
+	}
+	if strings.ContainsFunc(e.Description, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\r'
+	}) {
+		return errors.New("event description must not contain control characters")
+	}
+
+	var err error
+	if e.AllDay {
+		_, _, err = e.dates()
+	} else {
+		_, _, err = e.times()
+	}
+	return err
+}
+
+// dates parses an all-day event. The returned end is exclusive, as DTEND
+// requires, so a single-day event ends the following day.
+func (e *Event) dates() (start, end time.Time, err error) {
+	start, err = time.Parse(EventDateLayout, e.Start)
+	if err != nil {
+		return start, end, fmt.Errorf("start must be a date as YYYY-MM-DD")
+	}
+	end = start
+	if e.End != "" {
+		if end, err = time.Parse(EventDateLayout, e.End); err != nil {
+			return start, end, fmt.Errorf("end must be a date as YYYY-MM-DD")
+		}
+		if end.Before(start) {
+			return start, end, errors.New("event must not end before it starts")
+		}
+	}
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// times parses a timed event in its time zones. The end time zone defaults
+// to the start one.
+func (e *Event) times() (start, end time.Time, err error) {
+	startZone, err := loadZone(e.TimeZone)
+	if err != nil {
+		return start, end, err
+	}
+	endZone := startZone
+	if e.EndTimeZone != "" {
+		if endZone, err = loadZone(e.EndTimeZone); err != nil {
+			return start, end, err
+		}
+	}
+
+	start, err = time.ParseInLocation(EventDateTimeLayout, e.Start, startZone)
+	if err != nil {
+		return start, end, fmt.Errorf("start must be a time as YYYY-MM-DDTHH:MM")
+	}
+	if e.End == "" {
+		return start, start.Add(defaultEventDuration), nil
+	}
+	if end, err = time.ParseInLocation(EventDateTimeLayout, e.End, endZone); err != nil {
+		return start, end, fmt.Errorf("end must be a time as YYYY-MM-DDTHH:MM")
+	}
+	if !end.After(start) {
+		return start, end, errors.New("event must end after it starts")
+	}
+	return start, end, nil
+}
+
+// loadZone resolves an IANA time zone name, defaulting to UTC.
+func loadZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// icalEscaper escapes TEXT values as RFC 5545 section 3.3.11 requires.
+var icalEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`;`, `\;`,
+	`,`, `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+func escapeICal(s string) string {
+	return icalEscaper.Replace(s)
+}
+
+// foldICalLine splits a content line longer than 75 octets into CRLF-space
+// continuation lines, never breaking inside a UTF-8 sequence.
+func foldICalLine(s string) string {
+	if len(s) <= maxICalLine {
+		return s
+	}
+
+	var b strings.Builder
+	limit := maxICalLine
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines lose one octet to the leading space.
+		limit = maxICalLine - 1
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,102 @@
+// Package payload builds the structured contents that phones act on when
+// they scan a code, such as joining a Wi-Fi network, saving a contact,
+// adding a calendar event or starting a text message. Each payload keeps its
+// fields so a code can be edited later, and encodes them into the text that
+// is actually placed in the symbol.
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Payload is a structured code content.
+type Payload interface {
+	// Type names the payload kind, as stored alongside the code.
+	Type() string
+	// Encode validates the fields and returns the text to encode.
+	Encode() (string, error)
+	// Summary is a short human-readable description for listings.
+	Summary() string
+}
+
+// Payload types.
+const (
+	TypeURL       = "url"
+	TypeWiFi      = "wifi"
+	TypeContact   = "contact"
+	TypeEvent     = "event"
+	TypePayment   = "payment"
+	TypeSwissBill = "swissbill"
+	TypeSMS       = "sms"
+	TypePhone     = "phone"
+	TypeEmail     = "email"
+	TypeGeo       = "geo"
+	TypeOTP       = "otp"
+)
+
+// Kind describes a registered payload type.
+type Kind struct {
+	Type string
+	// Label names the type in forms and filters.
+	Label string
+	// Level is the error correction level the type's specification
+	// mandates, if any.
+	Level string
+	// Sensitive types carry credentials. Their codes are rendered without
+	// being stored unless the user opts in, and their content is kept out
+	// of logs and caches.
+	Sensitive bool
+	new       func() Payload
+}
+
+// kinds is the payload registry, in the order types are offered to users.
+var kinds = []Kind{
+	{Type: TypeURL, Label: "URL with UTM tags", new: func() Payload { return &URL{} }},
+	{Type: TypeWiFi, Label: "Wi-Fi", new: func() Payload { return &WiFi{} }},
+	{Type: TypeContact, Label: "Contact", new: func() Payload { return &Contact{} }},
+	{Type: TypeEvent, Label: "Event", new: func() Payload { return &Event{} }},
+	{Type: TypeSMS, Label: "SMS", new: func() Payload { return &SMS{} }},
+	{Type: TypePhone, Label: "Phone call", new: func() Payload { return &Phone{} }},
+	{Type: TypeEmail, Label: "Email", new: func() Payload { return &Email{} }},
+	{Type: TypeGeo, Label: "Location", new: func() Payload { return &Geo{} }},
+	{Type: TypeOTP, Label: "Authenticator (OTP)", Sensitive: true, new: func() Payload { return &OTP{} }},
+	{Type: TypePayment, Label: "SEPA payment", Level: PaymentLevel, new: func() Payload { return &Payment{} }},
+	{Type: TypeSwissBill, Label: "Swiss QR-bill", Level: SwissBillLevel, new: func() Payload { return &SwissBill{} }},
+}
+
+// Kinds returns the registered payload types.
+func Kinds() []Kind {
+	return slices.Clone(kinds)
+}
+
+// Lookup returns the registered payload type named typ.
+func Lookup(typ string) (Kind, bool) {
+	for _, k := range kinds {
+		if k.Type == typ {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// Parse decodes the JSON fields of a payload of the given type.
+func Parse(typ string, data []byte) (Payload, error) {
+	k, ok := Lookup(typ)
+	if !ok {
+		return nil, fmt.Errorf("unknown payload type %q", typ)
+	}
+	p := k.new()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", typ, err)
+	}
+	return p, nil
+}
+
+// RequiredLevel returns the error correction level mandated by the
+// specification of a payload type, if it has one.
+func RequiredLevel(typ string) (string, bool) {
+	k, _ := Lookup(typ)
+	return k.Level, k.Level != ""
+}
@@ -0,0 +1,657 @@
+package payload
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWiFiEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		wifi WiFi
+		want string
+	}{
+		{
+			name: "wpa",
+			wifi: WiFi{SSID: "Office", Security: SecurityWPA, Password: "correct horse"},
+			want: "WIFI:T:WPA;S:Office;P:correct horse;;",
+		},
+		{
+			name: "escaped",
+			wifi: WiFi{SSID: `Bob's "Cafe"; 2:4GHz`, Security: SecurityWPA, Password: `a\b,c;d:e"f`},
+			want: `WIFI:T:WPA;S:Bob's \"Cafe\"\; 2\:4GHz;P:a\\b\,c\;d\:e\"f;;`,
+		},
+		{
+			name: "open hidden",
+			wifi: WiFi{SSID: "Guest", Security: SecurityNone, Hidden: true},
+			want: "WIFI:T:nopass;S:Guest;H:true;;",
+		},
+		{
+			name: "wep hex",
+			wifi: WiFi{SSID: "Legacy", Security: SecurityWEP, Password: "0123456789"},
+			want: "WIFI:T:WEP;S:Legacy;P:0123456789;;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.wifi.Encode()
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWiFiValidate(t *testing.T) {
+	invalid := []WiFi{
+		{Security: SecurityWPA, Password: "password1"},
+		{SSID: "this network name is far too long to be valid", Security: SecurityNone},
+		{SSID: "Office", Security: SecurityWPA, Password: "short"},
+		{SSID: "Office", Security: SecurityWEP, Password: "abcdefg"},
+		{SSID: "Office", Security: SecurityWEP, Password: "zzzzzzzzzz"},
+		{SSID: "Guest", Security: SecurityNone, Password: "secret"},
+		{SSID: "Office", Security: "WPA4", Password: "password1"},
+	}
+
+	for _, w := range invalid {
+		if _, err := w.Encode(); err == nil {
+			t.Errorf("Expected error for %+v", w)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse(TypeWiFi, []byte(`{"ssid":"Office","security":"WPA","password":"password1","hidden":true}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	wifi, ok := p.(*WiFi)
+	if !ok {
+		t.Fatalf("Expected *WiFi, got %T", p)
+	}
+	if wifi.SSID != "Office" || !wifi.Hidden {
+		t.Errorf("Unexpected fields %+v", wifi)
+	}
+	if p.Summary() != "Wi-Fi: Office" {
+		t.Errorf("Unexpected summary %q", p.Summary())
+	}
+
+	if _, err := Parse("fax", []byte(`{}`)); err == nil {
+		t.Error("Expected error for unknown type")
+	}
+	if _, err := Parse(TypeWiFi, []byte(`not json`)); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+
+	// Every registered type builds payloads that report it.
+	for _, k := range Kinds() {
+		p, err := Parse(k.Type, []byte(`{}`))
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", k.Type, err)
+		}
+		if p.Type() != k.Type {
+			t.Errorf("Expected %q payload, got %q", k.Type, p.Type())
+		}
+	}
+	if level, ok := RequiredLevel(TypePayment); !ok || level != PaymentLevel {
+		t.Errorf("Expected payments to require level %s, got %q", PaymentLevel, level)
+	}
+	if _, ok := RequiredLevel(TypeSMS); ok {
+		t.Error("Expected no required level for SMS")
+	}
+}
+
+func TestContactEncode(t *testing.T) {
+	contact := Contact{
+		FirstName:  "Ada",
+		LastName:   "Lovelace",
+		Org:        "Analytical Engines, Ltd; London",
+		Phones:     []string{"+44 20 7946 0958"},
+		Emails:     []string{"ada@example.com"},
+		URL:        "https://example.com",
+		Street:     "12 St James's Square",
+		City:       "London",
+		PostalCode: "SW1Y 4LB",
+		Country:    "UK",
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: FormatVCard3,
+			want: "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Lovelace;Ada;;;\r\nFN:Ada Lovelace\r\n" +
+				"ORG:Analytical Engines\\, Ltd\\; London\r\nTEL:+44 20 7946 0958\r\nEMAIL:ada@example.com\r\n" +
+				"URL:https://example.com\r\nADR:;;12 St James's Square;London;;SW1Y 4LB;UK\r\nEND:VCARD\r\n",
+		},
+		{
+			format: FormatVCard4,
+			want: "BEGIN:VCARD\r\nVERSION:4.0\r\nN:Lovelace;Ada;;;\r\nFN:Ada Lovelace\r\n" +
+				"ORG:Analytical Engines\\, Ltd\\; London\r\nTEL;VALUE=uri:tel:+442079460958\r\nEMAIL:ada@example.com\r\n" +
+				"URL:https://example.com\r\nADR:;;12 St James's Square;London;;SW1Y 4LB;UK\r\nEND:VCARD\r\n",
+		},
+		{
+			format: FormatMeCard,
+			want: `MECARD:N:Lovelace,Ada;ORG:Analytical Engines\, Ltd\; London;TEL:+44 20 7946 0958;` +
+				`EMAIL:ada@example.com;URL:https\://example.com;ADR:,,12 St James's Square,London,,SW1Y 4LB,UK;;`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			c := contact
+			c.Format = tt.format
+			got, err := c.Encode()
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected\n%q\ngot\n%q", tt.want, got)
+			}
+		})
+	}
+
+	company := Contact{Org: "Acme", Format: FormatMeCard}
+	got, err := company.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if got != "MECARD:N:Acme;;" || company.Summary() != "Contact: Acme" {
+		t.Errorf("Unexpected company card %q, summary %q", got, company.Summary())
+	}
+}
+
+func TestContactValidate(t *testing.T) {
+	invalid := []Contact{
+		{},
+		{FirstName: "Ada", Phones: []string{"call me"}},
+		{FirstName: "Ada", Phones: []string{"12"}},
+		{FirstName: "Ada", Emails: []string{"ada@"}},
+		{FirstName: "Ada", Emails: []string{"Ada <ada@example.com>"}},
+		{FirstName: "Ada", URL: "javascript:alert(1)"},
+		{FirstName: "Ada", Street: "line one\nline two"},
+		{FirstName: "Ada", Format: "hcard"},
+	}
+
+	for _, c := range invalid {
+		if _, err := c.Encode(); err == nil {
+			t.Errorf("Expected error for %+v", c)
+		}
+	}
+}
+
+func TestEventEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name: "timed across zones",
+			event: Event{
+				Title: "Flight LHR-JFK", Start: "2026-07-01T10:00", End: "2026-07-01T13:00",
+				TimeZone: "Europe/London", EndTimeZone: "America/New_York",
+			},
+			want: "BEGIN:VEVENT\r\nUID:447fd04dada0a28bfebab6ed9337746d@qr-code-generator\r\nDTSTAMP:20260701T090000Z\r\n" +
+				"SUMMARY:Flight LHR-JFK\r\nDTSTART:20260701T090000Z\r\nDTEND:20260701T170000Z\r\nEND:VEVENT\r\n",
+		},
+		{
+			name:  "default end",
+			event: Event{Title: "Standup", Start: "2026-01-15T09:30", TimeZone: "Europe/Berlin"},
+			want: "BEGIN:VEVENT\r\nUID:37d36c9472c530d6a8fc1bb1b80c8dab@qr-code-generator\r\nDTSTAMP:20260115T083000Z\r\n" +
+				"SUMMARY:Standup\r\nDTSTART:20260115T083000Z\r\nDTEND:20260115T093000Z\r\nEND:VEVENT\r\n",
+		},
+		{
+			name:  "all day",
+			event: Event{Title: "Conference", Start: "2026-03-30", End: "2026-03-31", AllDay: true, Location: "Hall 1, Level 2"},
+			want: "BEGIN:VEVENT\r\nUID:b9208e4da318b3a54d907466d834a02a@qr-code-generator\r\nDTSTAMP:20260330T000000Z\r\n" +
+				"SUMMARY:Conference\r\nDTSTART;VALUE=DATE:20260330\r\nDTEND;VALUE=DATE:20260401\r\n" +
+				"LOCATION:Hall 1\\, Level 2\r\nEND:VEVENT\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.event.Encode()
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected\n%q\ngot\n%q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEventUID(t *testing.T) {
+	uid := func(e Event) string {
+		t.Helper()
+		got, err := e.Encode()
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		_, rest, _ := strings.Cut(got, "\r\nUID:")
+		id, _, _ := strings.Cut(rest, "\r\n")
+		return id
+	}
+
+	e := Event{Title: "Standup", Start: "2026-01-15T09:30", TimeZone: "Europe/Berlin"}
+	first := uid(e)
+	if first == "" || uid(e) != first {
+		t.Errorf("Expected a stable UID, got %q", first)
+	}
+	e.Location = "Room 4"
+	if uid(e) == first {
+		t.Error("Expected a different event to get a different UID")
+	}
+}
+
+func TestEventFolding(t *testing.T) {
+	e := Event{
+		Title:       "Launch",
+		Start:       "2026-05-01",
+		AllDay:      true,
+		Description: "Line one; with a semicolon\nLine two, which goes on for long enough to need folding — twice over, in fact, because RFC 5545 caps lines at 75 octets",
+	}
+	got, err := e.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var unfolded strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line %d is %d octets: %q", i, len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("Line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded.WriteString(line[1:])
+		} else {
+			unfolded.WriteString("\n" + line)
+		}
+	}
+	want := `DESCRIPTION:Line one\; with a semicolon\nLine two\, which goes on for long enough to need folding — twice over\, in fact\, because RFC 5545 caps lines at 75 octets`
+	if !strings.Contains(unfolded.String(), "\n"+want+"\n") {
+		t.Errorf("Expected unfolded description %q in\n%s", want, unfolded.String())
+	}
+}
+
+func TestEventValidate(t *testing.T) {
+	invalid := []Event{
+		{Start: "2026-05-01T10:00"},
+		{Title: "x", Start: "tomorrow"},
+		{Title: "x", Start: "2026-05-01T10:00", End: "2026-05-01T09:00"},
+		{Title: "x", Start: "2026-05-01T10:00", TimeZone: "Mars/Olympus"},
+		{Title: "x", Start: "2026-05-01T10:00", AllDay: true},
+		{Title: "x", Start: "2026-05-02", End: "2026-05-01", AllDay: true},
+		{Title: "x\ny", Start: "2026-05-01", AllDay: true},
+	}
+
+	for _, e := range invalid {
+		if _, err := e.Encode(); err == nil {
+			t.Errorf("Expected error for %+v", e)
+		}
+	}
+}
+
+func TestPaymentEncode(t *testing.T) {
+	p := Payment{
+		Beneficiary: "Red Cross of Belgium",
+		IBAN:        "be72 0000 0000 1616",
+		BIC:         "bpotbeb1",
+		Amount:      "1",
+		Remittance:  "Urgency fund",
+	}
+	got, err := p.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want := "BCD\n002\n1\nSCT\nBPOTBEB1\nRed Cross of Belgium\nBE72000000001616\nEUR1.00\n\n\nUrgency fund"
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+	if p.IBAN != "BE72000000001616" {
+		t.Errorf("Expected normalised IBAN, got %q", p.IBAN)
+	}
+	if p.Summary() != "Payment: EUR 1 to Red Cross of Belgium" {
+		t.Errorf("Unexpected summary %q", p.Summary())
+	}
+
+	// Without BIC or amount the payer fills them in.
+	open := Payment{Beneficiary: "Example GmbH", IBAN: "DE89370400440532013000", Reference: "RF18539007547034"}
+	got, err = open.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want = "BCD\n002\n1\nSCT\n\nExample GmbH\nDE89370400440532013000\n\n\nRF18539007547034"
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestPaymentValidate(t *testing.T) {
+	valid := Payment{Beneficiary: "Example GmbH", IBAN: "DE89370400440532013000"}
+	invalid := []func(p *Payment){
+		func(p *Payment) { p.Beneficiary = "" },
+		func(p *Payment) { p.Beneficiary = strings.Repeat("x", 71) },
+		func(p *Payment) { p.IBAN = "DE89370400440532013001" },
+		func(p *Payment) { p.IBAN = "DE8937" },
+		func(p *Payment) { p.IBAN = "1289370400440532013000" },
+		func(p *Payment) { p.BIC = "COBADEF" },
+		func(p *Payment) { p.Amount = "0" },
+		func(p *Payment) { p.Amount = "12,50" },
+		func(p *Payment) { p.Amount = "1.234" },
+		func(p *Payment) { p.Amount = "1000000000" },
+		func(p *Payment) { p.Currency = "USD" },
+		func(p *Payment) { p.Purpose = "gift" },
+		func(p *Payment) { p.Reference = "RF18"; p.Remittance = "both" },
+		func(p *Payment) { p.Reference = strings.Repeat("1", 36) },
+		func(p *Payment) { p.Remittance = strings.Repeat("é", 141) },
+		func(p *Payment) { p.Remittance = "line\nbreak" },
+	}
+
+	if _, err := valid.Encode(); err != nil {
+		t.Fatalf("Expected valid payment, got %v", err)
+	}
+	for i, mutate := range invalid {
+		p := valid
+		mutate(&p)
+		if _, err := p.Encode(); err == nil {
+			t.Errorf("Case %d: expected error for %+v", i, p)
+		}
+	}
+
+	// Every field within its own limit can still exceed the total.
+	long := Payment{
+		Beneficiary: strings.Repeat("é", 70),
+		IBAN:        "DE89370400440532013000",
+		Remittance:  strings.Repeat("é", 140),
+		Info:        strings.Repeat("x", 70),
+	}
+	if _, err := long.Encode(); err == nil || !strings.Contains(err.Error(), "331") {
+		t.Errorf("Expected byte limit error, got %v", err)
+	}
+}
+
+func TestSwissBillEncode(t *testing.T) {
+	// The example bill from the Swiss Implementation Guidelines.
+	b := SwissBill{
+		IBAN:     "CH44 3199 9123 0008 8901 2",
+		Creditor: SwissAddress{Name: "Robert Schneider AG", Street: "Rue du Lac", BuildingNumber: "1268", PostalCode: "2501", Town: "Biel", Country: "ch"},
+		Amount:   "1949.75",
+		Debtor: &SwissAddress{
+			Name: "Pia-Maria Rutschmann-Schnyder", Street: "Grosse Marktgasse", BuildingNumber: "28",
+			PostalCode: "9400", Town: "Rorschach", Country: "CH",
+		},
+		Reference: "21 00000 00003 13947 14300 09017",
+		Message:   "Auftrag vom 15.06.2020",
+		BillInfo:  "//S1/10/10201409/11/200701/20/140.000-53/30/102673831/31/200615/32/7.7/33/7.7:139.40/40/0:30",
+	}
+	got, err := b.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"SPC", "0200", "1", "CH4431999123000889012",
+		"S", "Robert Schneider AG", "Rue du Lac", "1268", "2501", "Biel", "CH",
+		"", "", "", "", "", "", "",
+		"1949.75", "CHF",
+		"S", "Pia-Maria Rutschmann-Schnyder", "Grosse Marktgasse", "28", "9400", "Rorschach", "CH",
+		"QRR", "210000000003139471430009017", "Auftrag vom 15.06.2020", "EPD",
+		"//S1/10/10201409/11/200701/20/140.000-53/30/102673831/31/200615/32/7.7/33/7.7:139.40/40/0:30",
+	}, "\r\n")
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+	if b.Summary() != "QR-bill: CHF 1949.75 to Robert Schneider AG" {
+		t.Errorf("Unexpected summary %q", b.Summary())
+	}
+
+	// A plain IBAN without reference or debtor, amount left to the payer.
+	open := SwissBill{
+		IBAN:     "CH5800791123000889012",
+		Creditor: SwissAddress{Name: "Verein", PostalCode: "3000", Town: "Bern", Country: "CH"},
+		Currency: "eur",
+	}
+	got, err = open.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !strings.Contains(got, "\r\n\r\nEUR\r\n") || !strings.HasSuffix(got, "\r\nNON\r\n\r\n\r\nEPD") {
+		t.Errorf("Unexpected payload %q", got)
+	}
+	if n := strings.Count(got, "\r\n"); n != 30 {
+		t.Errorf("Expected 31 elements, got %d", n+1)
+	}
+}
+
+func TestSwissBillValidate(t *testing.T) {
+	valid := SwissBill{
+		IBAN:      "CH5800791123000889012",
+		Creditor:  SwissAddress{Name: "Verein", PostalCode: "3000", Town: "Bern", Country: "CH"},
+		Reference: "RF18539007547034",
+	}
+	invalid := []func(b *SwissBill){
+		func(b *SwissBill) { b.IBAN = "DE89370400440532013000" },
+		func(b *SwissBill) { b.IBAN = "CH5800791123000889013" },
+		func(b *SwissBill) { b.IBAN = "CH4431999123000889012" },
+		func(b *SwissBill) { b.ReferenceType = ReferenceQRR },
+		func(b *SwissBill) { b.ReferenceType = ReferenceNone },
+		func(b *SwissBill) { b.ReferenceType = "ISR" },
+		func(b *SwissBill) { b.Reference = "RF18539007547035" },
+		func(b *SwissBill) { b.Reference = "RF18" + strings.Repeat("1", 22) },
+		func(b *SwissBill) { b.Creditor.Name = "" },
+		func(b *SwissBill) { b.Creditor.Town = strings.Repeat("x", 36) },
+		func(b *SwissBill) { b.Creditor.Country = "CHE" },
+		func(b *SwissBill) { b.Debtor = &SwissAddress{Name: "Payer"} },
+		func(b *SwissBill) { b.Amount = "0.001" },
+		func(b *SwissBill) { b.Currency = "USD" },
+		func(b *SwissBill) { b.Message = "Zahlung für Ω" },
+		func(b *SwissBill) { b.Message = "line\nbreak" },
+		func(b *SwissBill) { b.Message = strings.Repeat("x", 100); b.BillInfo = "//" + strings.Repeat("x", 39) },
+	}
+
+	if _, err := valid.Encode(); err != nil {
+		t.Fatalf("Expected valid bill, got %v", err)
+	}
+	for i, mutate := range invalid {
+		b := valid
+		mutate(&b)
+		if _, err := b.Encode(); err == nil {
+			t.Errorf("Case %d: expected error for %+v", i, b)
+		}
+	}
+
+	qr := SwissBill{IBAN: "CH4431999123000889012", Creditor: valid.Creditor}
+	for _, ref := range []string{"210000000003139471430009018", "2100000000031394714300090"} {
+		qr.Reference = ref
+		if _, err := qr.Encode(); err == nil {
+			t.Errorf("Expected error for QR reference %q", ref)
+		}
+	}
+}
+
+func TestURIPayloads(t *testing.T) {
+	tests := []struct {
+		payload Payload
+		want    string
+		summary string
+	}{
+		{&SMS{Number: "+41 79 123 45 67", Message: "Table 4: ready"}, "SMSTO:+41791234567:Table 4: ready", "SMS: +41 79 123 45 67"},
+		{&SMS{Number: "555-0100"}, "SMSTO:5550100:", "SMS: 555-0100"},
+		{&Phone{Number: "+1 (555) 010-0100"}, "tel:+1555010-0100", "Phone: +1 (555) 010-0100"},
+		{&Email{To: "info@example.com"}, "mailto:info@example.com", "Email: info@example.com"},
+		{
+			&Email{To: "info@example.com", Subject: "Order #12 & more", Body: "Hi,\nthanks"},
+			"mailto:info@example.com?subject=Order%20%2312%20%26%20more&body=Hi%2C%0D%0Athanks",
+			"Email: info@example.com",
+		},
+		{&Geo{Latitude: "47.3769", Longitude: "8.5417"}, "geo:47.3769,8.5417", "Location: 47.3769, 8.5417"},
+		{&Geo{Latitude: "-33.8568", Longitude: "151.2153", Label: "Opera House"}, "geo:-33.8568,151.2153?q=-33.8568%2C151.2153%28Opera+House%29", "Location: Opera House"},
+	}
+	for _, tt := range tests {
+		got, err := tt.payload.Encode()
+		if err != nil {
+			t.Errorf("Encode(%+v) failed: %v", tt.payload, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+		if tt.payload.Summary() != tt.summary {
+			t.Errorf("Expected summary %q, got %q", tt.summary, tt.payload.Summary())
+		}
+	}
+}
+
+func TestURIPayloadsValidate(t *testing.T) {
+	invalid := []Payload{
+		&SMS{Number: "12"},
+		&SMS{Number: "+41 79 123 45 67", Message: strings.Repeat("x", 919)},
+		&SMS{Number: "+41 79 123 45 67", Message: "bell\a"},
+		&Phone{Number: "call me"},
+		&Email{To: "Ada <ada@example.com>"},
+		&Email{To: "ada@example.com", Subject: "two\nlines"},
+		&Geo{Latitude: "91", Longitude: "0"},
+		&Geo{Latitude: "0", Longitude: "-180.5"},
+		&Geo{Latitude: "1e1", Longitude: "0"},
+		&Geo{Latitude: "47,37", Longitude: "8"},
+		&Geo{Latitude: "", Longitude: ""},
+	}
+	for _, p := range invalid {
+		if _, err := p.Encode(); err == nil {
+			t.Errorf("Expected error for %+v", p)
+		}
+	}
+}
+
+func TestOTPEncode(t *testing.T) {
+	o := OTP{Issuer: "Example Co", Account: "ops@example.com", Secret: "jbsw y3dp ehpk 3pxp"}
+	got, err := o.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want := "otpauth://totp/Example%20Co:ops@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example+Co"
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+	if o.Kind != OTPTOTP || o.Period != DefaultOTPPeriod || o.Digits != DefaultOTPDigits {
+		t.Errorf("Expected defaults to be filled in, got %+v", o)
+	}
+	if s := o.Summary(); s != "OTP: Example Co (ops@example.com)" || strings.Contains(s, o.Secret) {
+		t.Errorf("Unexpected summary %q", s)
+	}
+
+	h := OTP{Kind: OTPHOTP, Issuer: "ACME", Account: "root", Secret: "JBSWY3DPEHPK3PXP====", Algorithm: "sha256", Digits: 8, Counter: 7}
+	got, err = h.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want = "otpauth://hotp/ACME:root?secret=JBSWY3DPEHPK3PXP&issuer=ACME&algorithm=SHA256&digits=8&counter=7"
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestOTPValidate(t *testing.T) {
+	valid := OTP{Issuer: "Example", Account: "ops", Secret: "JBSWY3DPEHPK3PXP"}
+	invalid := []func(o *OTP){
+		func(o *OTP) { o.Kind = "sms" },
+		func(o *OTP) { o.Issuer = "" },
+		func(o *OTP) { o.Account = " " },
+		func(o *OTP) { o.Issuer = "Example:Prod" },
+		func(o *OTP) { o.Secret = "" },
+		func(o *OTP) { o.Secret = "JBSWY3DPEHPK3PX1" },
+		func(o *OTP) { o.Secret = "JBSWY3DP" },
+		func(o *OTP) { o.Algorithm = "MD5" },
+		func(o *OTP) { o.Digits = 7 },
+		func(o *OTP) { o.Period = 301 },
+		func(o *OTP) { o.Kind = OTPHOTP; o.Counter = -1 },
+	}
+
+	if _, err := valid.Encode(); err != nil {
+		t.Fatalf("Expected valid OTP, got %v", err)
+	}
+	for i, mutate := range invalid {
+		o := valid
+		mutate(&o)
+		_, err := o.Encode()
+		if err == nil {
+			t.Errorf("Case %d: expected error for %+v", i, o)
+			continue
+		}
+		if o.Secret != "" && strings.Contains(err.Error(), o.Secret) {
+			t.Errorf("Case %d: error %q repeats the secret", i, err)
+		}
+	}
+}
+
+func TestURLEncode(t *testing.T) {
+	tests := []struct {
+		payload URL
+		want    string
+		dest    string
+	}{
+		{
+			URL{URL: "https://example.com/sale", Source: "poster", Medium: "print", Campaign: "spring sale"},
+			"https://example.com/sale?utm_source=poster&utm_medium=print&utm_campaign=spring+sale",
+			"https://example.com/sale",
+		},
+		{
+			// Tags pasted with the URL are taken over, unless set as fields,
+			// and other parameters keep their place and encoding.
+			URL{URL: "https://example.com/p?id=7&utm_source=mail&x=a%20b&utm_campaign=old#top", Campaign: "new"},
+			"https://example.com/p?id=7&x=a%20b&utm_source=mail&utm_campaign=new#top",
+			"https://example.com/p?id=7&x=a%20b#top",
+		},
+		{URL{URL: " http://example.com "}, "http://example.com", "http://example.com"},
+	}
+	for _, tt := range tests {
+		got, err := tt.payload.Encode()
+		if err != nil {
+			t.Errorf("Encode(%+v) failed: %v", tt.payload, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+		if tt.payload.URL != tt.dest {
+			t.Errorf("Expected destination %q, got %q", tt.dest, tt.payload.URL)
+		}
+	}
+
+	u := URL{URL: "https://example.com/sale?utm_campaign=spring&utm_medium=print"}
+	if _, err := u.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if u.Scheme != "https" || u.Host != "example.com" || u.Path != "/sale" || u.Campaign != "spring" || u.Medium != "print" {
+		t.Errorf("Unexpected components %+v", u)
+	}
+	if u.Summary() != "URL: example.com/sale (spring)" {
+		t.Errorf("Unexpected summary %q", u.Summary())
+	}
+}
+
+func TestURLValidate(t *testing.T) {
+	invalid := []URL{
+		{URL: ""},
+		{URL: "example.com/sale"},
+		{URL: "ftp://example.com"},
+		{URL: "https://example.com", Source: strings.Repeat("x", maxUTMChars+1)},
+		{URL: "https://example.com", Campaign: "two\nlines"},
+		{URL: "https://example.com/" + strings.Repeat("a", maxURLChars)},
+	}
+	for _, u := range invalid {
+		if _, err := u.Encode(); err == nil {
+			t.Errorf("Expected error for %+v", u)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EPC069-12 limits. Field limits are in characters; the whole payload is
+// limited in bytes.
+const (
+	maxPaymentBytes       = 331
+	maxBeneficiaryChars   = 70
+	maxReferenceChars     = 35
+	maxRemittanceChars    = 140
+	maxPaymentInfoChars   = 70
+	maxPaymentAmountCents = 999999999_99
+)
+
+// PaymentCurrency is the only currency EPC069-12 allows.
+const PaymentCurrency = "EUR"
+
+// PaymentLevel is the error correction level EPC069-12 mandates.
+const PaymentLevel = "M"
+
+var (
+	bicPattern     = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	purposePattern = regexp.MustCompile(`^[A-Z]{4}$`)
+	amountPattern  = regexp.MustCompile(`^(\d{1,9})(?:\.(\d{1,2}))?$`)
+)
+
+// Payment is a SEPA credit transfer in the EPC069-12 format, also known as
+// GiroCode, which banking apps read to pre-fill a transfer.
+type Payment struct {
+	Beneficiary string `json:"beneficiary"`
+	IBAN        string `json:"iban"`
+	BIC         string `json:"bic,omitempty"`
+	// Amount is a decimal string such as "12.50", kept as text so it is
+	// never rounded. An empty amount lets the payer fill it in.
+	Amount   string `json:"amount,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+	// Reference is a structured creditor reference; Remittance is free
+	// text. At most one of them may be set.
+	Reference  string `json:"reference,omitempty"`
+	Remittance string `json:"remittance,omitempty"`
+	// Info is a note shown to the payer, not passed on with the transfer.
+	Info string `json:"info,omitempty"`
+}
+
+func (p *Payment) Type() string { return TypePayment }
+
+func (p *Payment) Summary() string {
+	if p.Amount == "" {
+		return "Payment to " + p.Beneficiary
+	}
+	return "Payment: " + PaymentCurrency + " " + p.Amount + " to " + p.Beneficiary
+}
+
+// Encode returns the payment as an EPC069-12 version 002 payload. The IBAN
+// and BIC are normalised to upper case without spaces.
+func (p *Payment) Encode() (string, error) {
+	p.IBAN = strings.ToUpper(strings.Join(strings.Fields(p.IBAN), ""))
+	p.BIC = strings.ToUpper(strings.Join(strings.Fields(p.BIC), ""))
+	if err := p.validate(); err != nil {
+		return "", err
+	}
+
+	amount := ""
+	if p.Amount != "" {
+		cents, err := parseAmount(p.Amount)
+		if err != nil {
+			return "", err
+		}
+		amount = fmt.Sprintf("%s%d.%02d", PaymentCurrency, cents/100, cents%100)
+	}
+
+	lines := []string{
+		"BCD",
+		"002", // version 002 makes the BIC optional within the EEA
+		"1",   // UTF-8
+		"SCT",
+		p.BIC,
+		p.Beneficiary,
+		p.IBAN,
+		amount,
+		p.Purpose,
+		p.Reference,
+		p.Remittance,
+		p.Info,
+	}
+	// Trailing empty fields may be left out.
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	s := strings.Join(lines, "\n")
+	if len(s) > maxPaymentBytes {
+		return "", fmt.Errorf("payment is %d bytes; EPC codes are limited to %d", len(s), maxPaymentBytes)
+	}
+	return s, nil
+}
+
+func (p *Payment) validate() error {
+	if p.Currency != "" && p.Currency != PaymentCurrency {
+		return fmt.Errorf("EPC payments must be in %s", PaymentCurrency)
+	}
+	for _, field := range []string{p.Beneficiary, p.Purpose, p.Reference, p.Remittance, p.Info} {
+		if strings.ContainsFunc(field, unicode.IsControl) {
+			return errors.New("payment fields must not contain line breaks or control characters")
+		}
+	}
+
+	if strings.TrimSpace(p.Beneficiary) == "" {
+		return errors.New("beneficiary is required")
+	}
+	if err := checkChars("beneficiary", p.Beneficiary, maxBeneficiaryChars); err != nil {
+		return err
+	}
+	if err := checkIBAN(p.IBAN); err != nil {
+		return err
+	}
+	if p.BIC != "" && !bicPattern.MatchString(p.BIC) {
+		return fmt.Errorf("invalid BIC %q", p.BIC)
+	}
+	if p.Amount != "" {
+		if _, err := parseAmount(p.Amount); err != nil {
+			return err
+		}
+	}
+	if p.Purpose != "" && !purposePattern.MatchString(p.Purpose) {
+		return errors.New("purpose must be a four-letter code")
+	}
+	if p.Reference != "" && p.Remittance != "" {
+		return errors.New("give either a structured reference or remittance text, not both")
+	}
+	if err := checkChars("reference", p.Reference, maxReferenceChars); err != nil {
+		return err
+	}
+	if err := checkChars("remittance text", p.Remittance, maxRemittanceChars); err != nil {
+		return err
+	}
+	return checkChars("note", p.Info, maxPaymentInfoChars)
+}
+
+// parseAmount returns a decimal amount in cents, which must be between 0.01
+// and 999999999.99.
+func parseAmount(s string) (int64, error) {
+	m := amountPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid amount %q: use digits with up to two decimals", s)
+	}
+	units, _ := strconv.ParseInt(m[1], 10, 64)
+	cents, _ := strconv.ParseInt((m[2] + "00")[:2], 10, 64)
+	total := units*100 + cents
+	if total < 1 || total > maxPaymentAmountCents {
+		return 0, errors.New("amount must be between 0.01 and 999999999.99")
+	}
+	return total, nil
+}
+
+// checkIBAN validates the structure and ISO 13616 mod-97 checksum of a
+// normalised IBAN.
+func checkIBAN(iban string) error {
+	if iban == "" {
+		return errors.New("IBAN is required")
+	}
+	if len(iban) < 15 || len(iban) > 34 {
+		return fmt.Errorf("invalid IBAN %q: wrong length", iban)
+	}
+	for i, c := range iban {
+		letter := c >= 'A' && c <= 'Z'
+		digit := c >= '0' && c <= '9'
+		if (i < 2 && !letter) || (i >= 2 && i < 4 && !digit) || (!letter && !digit) {
+			return fmt.Errorf("invalid IBAN %q", iban)
+		}
+	}
+
+	// Move the country code and check digits to the end.
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return fmt.Errorf("invalid IBAN %q: checksum does not match", iban)
+	}
+	return nil
+}
+
+// mod97 returns the ISO 7064 MOD 97-10 remainder of upper-case letters and
+// digits, with letters read as numbers (A=10 ... Z=35), as used by IBANs and
+// creditor references.
+func mod97(s string) int {
+	remainder := 0
+	for _, c := range s {
+		if c >= 'A' {
+			remainder = (remainder*100 + int(c-'A'+10)) % 97
+		} else {
+			remainder = (remainder*10 + int(c-'0')) % 97
+		}
+	}
+	return remainder
+}
+
+func checkChars(name, value string, limit int) error {
+	if n := utf8.RuneCountInString(value); n > limit {
+		return fmt.Errorf("%s must be at most %d characters", name, limit)
+	}
+	return nil
+}
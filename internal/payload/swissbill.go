@@ -0,0 +1,324 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Swiss Implementation Guidelines for the QR-bill, version 2.3, limits.
+// Field limits are in characters.
+const (
+	maxSwissBillChars     = 997
+	maxSwissNameChars     = 70
+	maxSwissStreetChars   = 70
+	maxSwissBuildingChars = 16
+	maxSwissPostCodeChars = 16
+	maxSwissTownChars     = 35
+	maxSwissInfoChars     = 140
+	maxSwissSCORChars     = 25
+	swissQRRDigits        = 27
+	swissIBANChars        = 21
+)
+
+// QR-bill reference types.
+const (
+	ReferenceQRR  = "QRR"  // 27-digit QR reference, only with a QR-IBAN
+	ReferenceSCOR = "SCOR" // ISO 11649 creditor reference
+	ReferenceNone = "NON"
+)
+
+// Currencies a QR-bill may be issued in; the first is the default.
+var swissBillCurrencies = []string{"CHF", "EUR"}
+
+// SwissBillLevel is the error correction level the QR-bill mandates.
+const SwissBillLevel = "M"
+
+// QR-IBANs are told apart by their institution ID, the five digits after the
+// check digits.
+const (
+	minQRIID = "30000"
+	maxQRIID = "31999"
+)
+
+// SwissAddress is a structured (type S) QR-bill address.
+type SwissAddress struct {
+	Name           string `json:"name"`
+	Street         string `json:"street,omitempty"`
+	BuildingNumber string `json:"building_number,omitempty"`
+	PostalCode     string `json:"postal_code"`
+	Town           string `json:"town"`
+	Country        string `json:"country"`
+}
+
+// SwissBill is the payment part of a Swiss QR-bill, which replaced the
+// orange and red payment slips. Its symbol must be printed 46 mm wide with
+// the Swiss cross over the centre.
+type SwissBill struct {
+	IBAN     string       `json:"iban"`
+	Creditor SwissAddress `json:"creditor"`
+	// Amount is a decimal string as for Payment; an empty amount lets the
+	// payer fill it in.
+	Amount   string `json:"amount,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	// Debtor is the payer, if known.
+	Debtor        *SwissAddress `json:"debtor,omitempty"`
+	ReferenceType string        `json:"reference_type,omitempty"`
+	Reference     string        `json:"reference,omitempty"`
+	// Message is unstructured text for the payer; BillInfo is structured
+	// billing information for the payer's software.
+	Message  string `json:"message,omitempty"`
+	BillInfo string `json:"bill_info,omitempty"`
+}
+
+func (b *SwissBill) Type() string { return TypeSwissBill }
+
+func (b *SwissBill) Summary() string {
+	if b.Amount == "" {
+		return "QR-bill to " + b.Creditor.Name
+	}
+	return "QR-bill: " + b.Currency + " " + b.Amount + " to " + b.Creditor.Name
+}
+
+// Encode returns the bill as a version 2.0 SPC payload with CRLF line
+// separators. The IBAN and reference are normalised to upper case without
+// spaces, country codes to upper case, the currency defaults to CHF and the
+// reference type to the one the IBAN calls for.
+func (b *SwissBill) Encode() (string, error) {
+	b.IBAN = strings.ToUpper(strings.Join(strings.Fields(b.IBAN), ""))
+	b.Reference = strings.ToUpper(strings.Join(strings.Fields(b.Reference), ""))
+	b.Currency = strings.ToUpper(b.Currency)
+	b.Creditor.Country = strings.ToUpper(b.Creditor.Country)
+	if b.Debtor != nil {
+		b.Debtor.Country = strings.ToUpper(b.Debtor.Country)
+	}
+	if b.Currency == "" {
+		b.Currency = swissBillCurrencies[0]
+	}
+	if b.ReferenceType == "" {
+		b.ReferenceType = b.defaultReferenceType()
+	}
+	if err := b.validate(); err != nil {
+		return "", err
+	}
+
+	amount := ""
+	if b.Amount != "" {
+		cents, err := parseAmount(b.Amount)
+		if err != nil {
+			return "", err
+		}
+		amount = fmt.Sprintf("%d.%02d", cents/100, cents%100)
+	}
+
+	lines := []string{
+		"SPC",
+		"0200",
+		"1", // UTF-8, restricted to the Latin character set
+		b.IBAN,
+	}
+	lines = append(lines, b.Creditor.fields()...)
+	// The ultimate creditor is reserved for future use and must be empty.
+	lines = append(lines, make([]string, 7)...)
+	lines = append(lines, amount, b.Currency)
+	if b.Debtor != nil {
+		lines = append(lines, b.Debtor.fields()...)
+	} else {
+		lines = append(lines, make([]string, 7)...)
+	}
+	lines = append(lines, b.ReferenceType, b.Reference, b.Message, "EPD")
+	if b.BillInfo != "" {
+		lines = append(lines, b.BillInfo)
+	}
+
+	s := strings.Join(lines, "\r\n")
+	if n := utf8.RuneCountInString(s); n > maxSwissBillChars {
+		return "", fmt.Errorf("QR-bill is %d characters; the limit is %d", n, maxSwissBillChars)
+	}
+	return s, nil
+}
+
+func (b *SwissBill) defaultReferenceType() string {
+	switch {
+	case isQRIBAN(b.IBAN):
+		return ReferenceQRR
+	case b.Reference != "":
+		return ReferenceSCOR
+	}
+	return ReferenceNone
+}
+
+func (b *SwissBill) validate() error {
+	if err := checkSwissIBAN(b.IBAN); err != nil {
+		return err
+	}
+	if err := b.Creditor.validate("creditor"); err != nil {
+		return err
+	}
+	if b.Debtor != nil {
+		if err := b.Debtor.validate("debtor"); err != nil {
+			return err
+		}
+	}
+	if b.Amount != "" {
+		if _, err := parseAmount(b.Amount); err != nil {
+			return err
+		}
+	}
+	if !slices.Contains(swissBillCurrencies, b.Currency) {
+		return fmt.Errorf("QR-bills must be in %s", strings.Join(swissBillCurrencies, " or "))
+	}
+	if err := b.checkReference(); err != nil {
+		return err
+	}
+
+	for _, field := range []string{b.Message, b.BillInfo} {
+		if err := checkSwissChars(field); err != nil {
+			return err
+		}
+	}
+	if utf8.RuneCountInString(b.Message)+utf8.RuneCountInString(b.BillInfo) > maxSwissInfoChars {
+		return fmt.Errorf("message and billing information must be at most %d characters together", maxSwissInfoChars)
+	}
+	if strings.HasPrefix(b.BillInfo, "EPD") {
+		return errors.New("billing information must not start with EPD")
+	}
+	return nil
+}
+
+// checkReference matches the reference to its type, and the type to the
+// IBAN: QR references go with QR-IBANs and nothing else does.
+func (b *SwissBill) checkReference() error {
+	qrIBAN := isQRIBAN(b.IBAN)
+	switch b.ReferenceType {
+	case ReferenceQRR:
+		if !qrIBAN {
+			return errors.New("QR references need a QR-IBAN")
+		}
+		return checkQRReference(b.Reference)
+	case ReferenceSCOR:
+		if qrIBAN {
+			return errors.New("a QR-IBAN needs a QR reference")
+		}
+		return checkCreditorReference(b.Reference)
+	case ReferenceNone:
+		if qrIBAN {
+			return errors.New("a QR-IBAN needs a QR reference")
+		}
+		if b.Reference != "" {
+			return fmt.Errorf("reference type %s takes no reference", ReferenceNone)
+		}
+		return nil
+	}
+	return fmt.Errorf("reference type must be %s, %s or %s", ReferenceQRR, ReferenceSCOR, ReferenceNone)
+}
+
+// fields returns the seven address elements of a structured address.
+func (a *SwissAddress) fields() []string {
+	return []string{"S", a.Name, a.Street, a.BuildingNumber, a.PostalCode, a.Town, a.Country}
+}
+
+func (a *SwissAddress) validate(role string) error {
+	for _, f := range []struct {
+		name     string
+		value    string
+		limit    int
+		required bool
+	}{
+		{"name", a.Name, maxSwissNameChars, true},
+		{"street", a.Street, maxSwissStreetChars, false},
+		{"building number", a.BuildingNumber, maxSwissBuildingChars, false},
+		{"postal code", a.PostalCode, maxSwissPostCodeChars, true},
+		{"town", a.Town, maxSwissTownChars, true},
+	} {
+		if f.required && strings.TrimSpace(f.value) == "" {
+			return fmt.Errorf("%s %s is required", role, f.name)
+		}
+		if err := checkChars(role+" "+f.name, f.value, f.limit); err != nil {
+			return err
+		}
+		if err := checkSwissChars(f.value); err != nil {
+			return err
+		}
+	}
+	if len(a.Country) != 2 || a.Country[0] < 'A' || a.Country[0] > 'Z' || a.Country[1] < 'A' || a.Country[1] > 'Z' {
+		return fmt.Errorf("%s country must be a two-letter ISO code", role)
+	}
+	return nil
+}
+
+// checkSwissIBAN accepts Swiss and Liechtenstein IBANs, the only ones a
+// QR-bill may be paid to.
+func checkSwissIBAN(iban string) error {
+	if err := checkIBAN(iban); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(iban, "CH") && !strings.HasPrefix(iban, "LI") {
+		return errors.New("QR-bills must be paid to a CH or LI IBAN")
+	}
+	if len(iban) != swissIBANChars {
+		return fmt.Errorf("invalid IBAN %q: wrong length", iban)
+	}
+	return nil
+}
+
+// isQRIBAN reports whether a Swiss IBAN is a QR-IBAN.
+func isQRIBAN(iban string) bool {
+	if len(iban) != swissIBANChars {
+		return false
+	}
+	iid := iban[4:9]
+	return iid >= minQRIID && iid <= maxQRIID
+}
+
+// qrrCarry is the table of the recursive mod-10 check digit algorithm used
+// by QR references and the old ESR reference numbers.
+var qrrCarry = [10]int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+
+// checkQRReference validates a 27-digit QR reference and its check digit.
+func checkQRReference(ref string) error {
+	if len(ref) != swissQRRDigits || strings.ContainsFunc(ref, func(r rune) bool { return r < '0' || r > '9' }) {
+		return fmt.Errorf("QR reference must be %d digits", swissQRRDigits)
+	}
+	carry := 0
+	for _, c := range ref[:len(ref)-1] {
+		carry = qrrCarry[(carry+int(c-'0'))%10]
+	}
+	if check := (10 - carry) % 10; int(ref[len(ref)-1]-'0') != check {
+		return fmt.Errorf("invalid QR reference %q: check digit does not match", ref)
+	}
+	return nil
+}
+
+// checkCreditorReference validates an ISO 11649 creditor reference: RF, two
+// check digits and up to 21 letters or digits.
+func checkCreditorReference(ref string) error {
+	if len(ref) < 5 || len(ref) > maxSwissSCORChars || !strings.HasPrefix(ref, "RF") {
+		return fmt.Errorf("invalid creditor reference %q: must start with RF and be 5 to %d characters", ref, maxSwissSCORChars)
+	}
+	for _, c := range ref[2:] {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return fmt.Errorf("invalid creditor reference %q", ref)
+		}
+	}
+	if ref[2] > '9' || ref[3] > '9' || mod97(ref[4:]+ref[:4]) != 1 {
+		return fmt.Errorf("invalid creditor reference %q: checksum does not match", ref)
+	}
+	return nil
+}
+
+// checkSwissChars rejects characters outside the Latin subset QR-bills
+// permit: printable Basic Latin, Latin-1 Supplement and Latin Extended-A,
+// plus Ș, ș, Ț, ț and €.
+func checkSwissChars(s string) error {
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r <= 0x7e, r >= 0xa0 && r <= 0x17f, r >= 0x218 && r <= 0x21b, r == '€':
+		default:
+			return fmt.Errorf("QR-bills cannot contain %q", r)
+		}
+	}
+	return nil
+}
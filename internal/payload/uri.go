@@ -0,0 +1,181 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Bounds on message-style payloads. A text message longer than this is split
+// into many SMS parts, and mailto: URIs beyond a couple of thousand
+// characters are truncated by some mail clients.
+const (
+	maxSMSChars       = 918 // six concatenated GSM-7 parts
+	maxEmailBodyChars = 2000
+	maxSubjectChars   = 255
+	maxGeoLabelChars  = 100
+)
+
+// coordinatePattern accepts plain decimal degrees, without exponents.
+var coordinatePattern = regexp.MustCompile(`^-?\d{1,3}(\.\d{1,10})?$`)
+
+// SMS opens a text message to Number, pre-filled with Message, in the SMSTO:
+// format that Android and iOS camera apps both read.
+type SMS struct {
+	Number  string `json:"number"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *SMS) Type() string { return TypeSMS }
+
+func (s *SMS) Summary() string { return "SMS: " + s.Number }
+
+// Encode returns SMSTO:<number>:<message>. The message is the rest of the
+// payload, so it needs no escaping.
+func (s *SMS) Encode() (string, error) {
+	s.Number = strings.TrimSpace(s.Number)
+	if !validPhone(s.Number) {
+		return "", fmt.Errorf("invalid phone number %q", s.Number)
+	}
+	if err := checkChars("message", s.Message, maxSMSChars); err != nil {
+		return "", err
+	}
+	if strings.ContainsFunc(s.Message, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\r'
+	}) {
+		return "", errors.New("message must not contain control characters")
+	}
+	return "SMSTO:" + strings.Map(dialRune, s.Number) + ":" + s.Message, nil
+}
+
+// Phone starts a call, as an RFC 3966 tel: URI.
+type Phone struct {
+	Number string `json:"number"`
+}
+
+func (p *Phone) Type() string { return TypePhone }
+
+func (p *Phone) Summary() string { return "Phone: " + p.Number }
+
+func (p *Phone) Encode() (string, error) {
+	p.Number = strings.TrimSpace(p.Number)
+	if !validPhone(p.Number) {
+		return "", fmt.Errorf("invalid phone number %q", p.Number)
+	}
+	return "tel:" + strings.Map(telURIRune, p.Number), nil
+}
+
+// Email opens a new message in the mail app, as an RFC 6068 mailto: URI.
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+func (e *Email) Type() string { return TypeEmail }
+
+func (e *Email) Summary() string { return "Email: " + e.To }
+
+func (e *Email) Encode() (string, error) {
+	e.To = strings.TrimSpace(e.To)
+	if addr, err := mail.ParseAddress(e.To); err != nil || addr.Address != e.To {
+		return "", fmt.Errorf("invalid email address %q", e.To)
+	}
+	if strings.ContainsFunc(e.Subject, unicode.IsControl) {
+		return "", errors.New("subject must not contain line breaks or control characters")
+	}
+	if err := checkChars("subject", e.Subject, maxSubjectChars); err != nil {
+		return "", err
+	}
+	if err := checkChars("body", e.Body, maxEmailBodyChars); err != nil {
+		return "", err
+	}
+
+	var query []string
+	if e.Subject != "" {
+		query = append(query, "subject="+mailtoEscape(e.Subject))
+	}
+	if e.Body != "" {
+		// RFC 6068 wants line breaks in the body as CRLF.
+		body := strings.ReplaceAll(strings.ReplaceAll(e.Body, "\r\n", "\n"), "\n", "\r\n")
+		query = append(query, "body="+mailtoEscape(body))
+	}
+
+	uri := "mailto:" + url.PathEscape(e.To)
+	if len(query) > 0 {
+		uri += "?" + strings.Join(query, "&")
+	}
+	return uri, nil
+}
+
+// mailtoEscape percent-encodes a header value. Mail clients do not read +
+// as a space, so spaces are written as %20.
+func mailtoEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// Geo opens a map at a point, as an RFC 5870 geo: URI. Coordinates are
+// decimal degree strings, kept as text so they are encoded exactly as
+// entered.
+type Geo struct {
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
+	// Label names the place; Android maps show it as the search query.
+	Label string `json:"label,omitempty"`
+}
+
+func (g *Geo) Type() string { return TypeGeo }
+
+func (g *Geo) Summary() string {
+	if g.Label != "" {
+		return "Location: " + g.Label
+	}
+	return "Location: " + g.Latitude + ", " + g.Longitude
+}
+
+func (g *Geo) Encode() (string, error) {
+	g.Latitude = strings.TrimSpace(g.Latitude)
+	g.Longitude = strings.TrimSpace(g.Longitude)
+	if err := checkCoordinate("latitude", g.Latitude, 90); err != nil {
+		return "", err
+	}
+	if err := checkCoordinate("longitude", g.Longitude, 180); err != nil {
+		return "", err
+	}
+	if strings.ContainsFunc(g.Label, unicode.IsControl) {
+		return "", errors.New("label must not contain line breaks or control characters")
+	}
+	if err := checkChars("label", g.Label, maxGeoLabelChars); err != nil {
+		return "", err
+	}
+
+	uri := "geo:" + g.Latitude + "," + g.Longitude
+	if g.Label != "" {
+		uri += "?q=" + url.QueryEscape(g.Latitude+","+g.Longitude+"("+g.Label+")")
+	}
+	return uri, nil
+}
+
+func checkCoordinate(name, value string, limit float64) error {
+	if !coordinatePattern.MatchString(value) {
+		return fmt.Errorf("%s must be in decimal degrees, such as 47.3769", name)
+	}
+	if v, _ := strconv.ParseFloat(value, 64); v < -limit || v > limit {
+		return fmt.Errorf("%s must be between -%g and %g", name, limit, limit)
+	}
+	return nil
+}
+
+// dialRune keeps the characters of a number that a dialler needs: digits
+// and a leading +.
+func dialRune(r rune) rune {
+	if r == '+' || (r >= '0' && r <= '9') {
+		return r
+	}
+	return -1
+}
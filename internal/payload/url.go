@@ -0,0 +1,134 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Bounds on URL payloads. Longer URLs make dense symbols that cheap phone
+// cameras struggle with.
+const (
+	maxURLChars = 2048
+	maxUTMChars = 200
+)
+
+// URL opens a web page whose address carries Google Analytics UTM tags. The
+// destination is kept apart from the tags, so campaigns can be changed and
+// listed without editing the address by hand.
+type URL struct {
+	// URL is the destination without UTM tags. Tags pasted along with it
+	// are moved into the fields below, unless those are already set.
+	URL      string `json:"url"`
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+	// Scheme, Host and Path are parsed from URL by Encode.
+	Scheme string `json:"scheme,omitempty"`
+	Host   string `json:"host,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+func (u *URL) Type() string { return TypeURL }
+
+func (u *URL) Summary() string {
+	summary := "URL: " + u.Host + u.Path
+	if u.Campaign != "" {
+		summary += " (" + u.Campaign + ")"
+	}
+	return summary
+}
+
+// CheckUTMTag validates the value of the UTM tag name, such as
+// utm_campaign.
+func CheckUTMTag(name, value string) error {
+	if err := checkChars(name, value, maxUTMChars); err != nil {
+		return err
+	}
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return fmt.Errorf("%s must not contain control characters", name)
+	}
+	return nil
+}
+
+// utmField is a UTM tag name and the field of a URL payload holding it.
+type utmField struct {
+	name  string
+	value *string
+}
+
+// utmFields returns the tags of u in the order they are appended to the URL.
+func (u *URL) utmFields() []utmField {
+	return []utmField{
+		{"utm_source", &u.Source},
+		{"utm_medium", &u.Medium},
+		{"utm_campaign", &u.Campaign},
+		{"utm_term", &u.Term},
+		{"utm_content", &u.Content},
+	}
+}
+
+// Encode returns the destination with the UTM tags appended after its own
+// query parameters, which keep their order and encoding.
+func (u *URL) Encode() (string, error) {
+	dest, err := url.Parse(strings.TrimSpace(u.URL))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if dest.Scheme != "http" && dest.Scheme != "https" || dest.Host == "" {
+		return "", errors.New("URL must be an absolute http or https URL")
+	}
+
+	fields := u.utmFields()
+	var kept []string
+	for _, pair := range strings.Split(dest.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			return "", fmt.Errorf("invalid URL query: %w", err)
+		}
+		i := -1
+		for j, f := range fields {
+			if f.name == name {
+				i = j
+			}
+		}
+		if i < 0 {
+			kept = append(kept, pair)
+			continue
+		}
+		if *fields[i].value == "" {
+			if *fields[i].value, err = url.QueryUnescape(value); err != nil {
+				return "", fmt.Errorf("invalid URL query: %w", err)
+			}
+		}
+	}
+	dest.RawQuery = strings.Join(kept, "&")
+	u.URL = dest.String()
+	u.Scheme, u.Host, u.Path = dest.Scheme, dest.Host, dest.Path
+
+	tagged := kept
+	for _, f := range fields {
+		*f.value = strings.TrimSpace(*f.value)
+		if err := CheckUTMTag(f.name, *f.value); err != nil {
+			return "", err
+		}
+		if *f.value != "" {
+			tagged = append(tagged, f.name+"="+url.QueryEscape(*f.value))
+		}
+	}
+	dest.RawQuery = strings.Join(tagged, "&")
+
+	encoded := dest.String()
+	if err := checkChars("URL", encoded, maxURLChars); err != nil {
+		return "", err
+	}
+	return encoded, nil
+}
@@ -0,0 +1,106 @@
+package payload
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Wi-Fi security types, as written after T: in the payload.
+const (
+	SecurityWPA  = "WPA"
+	SecurityWEP  = "WEP"
+	SecurityNone = "nopass"
+)
+
+// WiFi joins a wireless network, in the WIFI: format understood by Android
+// and iOS camera apps. SecurityWPA also covers WPA2 and WPA3 personal networks.
+type WiFi struct {
+	SSID     string `json:"ssid"`
+	Security string `json:"security"`
+	Password string `json:"password,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty"`
+}
+
+func (w *WiFi) Type() string { return TypeWiFi }
+
+func (w *WiFi) Summary() string { return "Wi-Fi: " + w.SSID }
+
+// Encode returns the payload as WIFI:T:<security>;S:<ssid>;P:<password>;H:true;;
+func (w *WiFi) Encode() (string, error) {
+	if err := w.validate(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("WIFI:T:")
+	b.WriteString(w.Security)
+	b.WriteString(";S:")
+	b.WriteString(escapeField(w.SSID))
+	b.WriteString(";")
+	if w.Security != SecurityNone {
+		b.WriteString("P:")
+		b.WriteString(escapeField(w.Password))
+		b.WriteString(";")
+	}
+	if w.Hidden {
+		b.WriteString("H:true;")
+	}
+	b.WriteString(";")
+	return b.String(), nil
+}
+
+func (w *WiFi) validate() error {
+	if w.SSID == "" {
+		return errors.New("network name is required")
+	}
+	if len(w.SSID) > 32 {
+		return errors.New("network name must be at most 32 bytes")
+	}
+
+	switch w.Security {
+	case SecurityWPA:
+		// A passphrase of 8-63 characters, or a raw 256-bit key in hex.
+		if n := len(w.Password); (n < 8 || n > 63) && !(n == 64 && isHex(w.Password)) {
+			return errors.New("WPA password must be 8 to 63 characters")
+		}
+	case SecurityWEP:
+		// 40 or 104-bit keys, as ASCII or hex.
+		switch n := len(w.Password); {
+		case n == 5 || n == 13:
+		case (n == 10 || n == 26) && isHex(w.Password):
+		default:
+			return errors.New("WEP key must be 5 or 13 characters, or 10 or 26 hex digits")
+		}
+	case SecurityNone:
+		if w.Password != "" {
+			return errors.New("open networks have no password")
+		}
+	default:
+		return fmt.Errorf("security must be %s, %s or %s", SecurityWPA, SecurityWEP, SecurityNone)
+	}
+	return nil
+}
+
+// fieldEscaper backslash-escapes the characters that delimit the fields of
+// WIFI: and MECARD: payloads.
+var fieldEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`;`, `\;`,
+	`,`, `\,`,
+	`:`, `\:`,
+	`"`, `\"`,
+)
+
+func escapeField(s string) string {
+	return fieldEscaper.Replace(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return s != ""
+}
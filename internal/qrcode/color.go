@@ -0,0 +1,91 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinContrast is the lowest WCAG contrast ratio between foreground and
+// background that we will render. Below it many phone cameras fail to
+// separate dark from light modules.
+const MinContrast = 3.0
+
+// Transparent is the textual form of a fully transparent colour.
+const Transparent = "transparent"
+
+var (
+	DefaultForeground = color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff}
+	DefaultBackground = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// ErrLowContrast is returned when the requested colours are unlikely to scan.
+var ErrLowContrast = errors.New("foreground and background colours do not contrast enough")
+
+// ParseColor parses "#rgb", "#rrggbb" or "transparent".
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == Transparent {
+		return color.RGBA{}, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// FormatColor returns c as "#rrggbb", or "transparent" when it has no alpha.
+func FormatColor(c color.Color) string {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return Transparent
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// checkContrast rejects colour pairs that will not scan reliably: a
+// translucent foreground, light-on-dark (inverted) symbols, and pairs below
+// MinContrast. A transparent background is judged against white, the usual
+// surface for overlays.
+func checkContrast(fg, bg color.Color) error {
+	if _, _, _, a := fg.RGBA(); a != 0xffff {
+		return fmt.Errorf("%w: foreground colour must be opaque", ErrLowContrast)
+	}
+	if _, _, _, a := bg.RGBA(); a == 0 {
+		bg = DefaultBackground
+	}
+
+	lf, lb := luminance(fg), luminance(bg)
+	if lf >= lb {
+		return fmt.Errorf("%w: foreground must be darker than background", ErrLowContrast)
+	}
+	if ratio := (lb + 0.05) / (lf + 0.05); ratio < MinContrast {
+		return fmt.Errorf("%w: ratio %.2f is below %.1f", ErrLowContrast, ratio, MinContrast)
+	}
+	return nil
+}
+
+// luminance is the WCAG relative luminance of c.
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	linear := func(v uint32) float64 {
+		s := float64(v) / 0xffff
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
@@ -1,18 +1,150 @@
 package qrcode
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
 
 	qr "github.com/skip2/go-qrcode"
 )
 
 const (
-	DefaultSize   = 256
-	RecoveryLevel = qr.Medium
+	DefaultSize       = 256
+	DefaultModuleSize = 8
+	DefaultQuietZone  = 4
+	DefaultLevel      = LevelMedium
 )
 
+// Level is an error correction level as named by the QR specification. Higher
+// levels survive more damage at the cost of a denser symbol.
+type Level string
+
+const (
+	LevelLow      Level = "L" // ~7% of codewords recoverable
+	LevelMedium   Level = "M" // ~15%
+	LevelQuartile Level = "Q" // ~25%
+	LevelHigh     Level = "H" // ~30%
+)
+
+// ParseLevel parses one of L, M, Q or H (case-insensitive). An empty string
+// yields DefaultLevel.
+func ParseLevel(s string) (Level, error) {
+	switch l := Level(strings.ToUpper(strings.TrimSpace(s))); l {
+	case "":
+		return DefaultLevel, nil
+	case LevelLow, LevelMedium, LevelQuartile, LevelHigh:
+		return l, nil
+	default:
+		return "", fmt.Errorf("invalid error correction level %q", s)
+	}
+}
+
+func (l Level) recovery() qr.RecoveryLevel {
+	switch l {
+	case LevelLow:
+		return qr.Low
+	case LevelQuartile:
+		return qr.High
+	case LevelHigh:
+		return qr.Highest
+	default:
+		return qr.Medium
+	}
+}
+
+// Options controls how a symbol is rendered. A non-positive Size or
+// ModuleSize, a negative QuietZone, an empty Level or Style, a nil colour or
+// a zero LogoPercent falls back to the package default.
+type Options struct {
+	// Size is the width and height of PNG output in pixels.
+	Size int
+	// Level is the error correction level.
+	Level Level
+	// ModuleSize is the edge length of one module in SVG output units.
+	ModuleSize int
+	// QuietZone is the width of the blank margin around the symbol, in modules.
+	QuietZone int
+	// Style is the shape of dark modules.
+	Style Style
+	// Foreground is the colour of dark modules. It must be opaque.
+	Foreground color.Color
+	// Background is the colour of light modules and the quiet zone. A colour
+	// with zero alpha produces a transparent background.
+	Background color.Color
+	// Logo, when set, is drawn over the centre of the symbol. It forces
+	// LevelHigh so the hidden modules can be recovered.
+	Logo image.Image
+	// LogoPercent is the share of the symbol area, in percent, given to Logo.
+	LogoPercent int
+	// SwissQRBill renders to the Swiss QR-bill specification: the Swiss cross
+	// over the centre, black on white whatever Foreground and Background
+	// say, LevelMedium and a quiet zone of at least 5 mm. SVG and
+	// PDF output is sized so the symbol prints exactly 46 mm wide. It cannot
+	// be combined with Logo.
+	SwissQRBill bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.Size <= 0 {
+		o.Size = DefaultSize
+	}
+	if o.Level == "" {
+		o.Level = DefaultLevel
+	}
+	if o.ModuleSize <= 0 {
+		o.ModuleSize = DefaultModuleSize
+	}
+	if o.QuietZone < 0 {
+		o.QuietZone = DefaultQuietZone
+	}
+	if o.Style == "" {
+		o.Style = DefaultStyle
+	}
+	if o.Foreground == nil {
+		o.Foreground = DefaultForeground
+	}
+	if o.Background == nil {
+		o.Background = DefaultBackground
+	}
+	if o.Logo != nil {
+		o.Level = LevelHigh
+		if o.LogoPercent == 0 {
+			o.LogoPercent = DefaultLogoPercent
+		}
+	}
+	if o.SwissQRBill {
+		o.Level = LevelMedium
+		o.Foreground, o.Background = DefaultForeground, DefaultBackground
+	}
+	return o
+}
+
+// EffectiveLevel is the error correction level a symbol will actually be
+// encoded with, which differs from Level when a logo or SwissQRBill forces a level.
+func (o Options) EffectiveLevel() Level {
+	return o.withDefaults().Level
+}
+
+// DefaultOptions returns the options used when a caller has no preference.
+func DefaultOptions() Options {
+	return Options{
+		Size:       DefaultSize,
+		Level:      DefaultLevel,
+		ModuleSize: DefaultModuleSize,
+		QuietZone:  DefaultQuietZone,
+		Style:      DefaultStyle,
+		Foreground: DefaultForeground,
+		Background: DefaultBackground,
+	}
+}
+
 type Generator struct {
-	size int
+	size   int
+	verify bool
 }
 
 func New() *Generator {
@@ -21,32 +153,129 @@ func New() *Generator {
 	}
 }
 
+// SetVerify controls whether PNG output is decoded again after rendering.
+// When enabled, GeneratePNG fails with ErrVerificationFailed instead of
+// returning an image that does not scan back to its content.
+func (g *Generator) SetVerify(enabled bool) {
+	g.verify = enabled
+}
+
+// Unverified returns a copy of the generator that does not decode its
+// output, for renders that are not worth the cost of a decode.
+func (g *Generator) Unverified() *Generator {
+	u := *g
+	u.verify = false
+	return &u
+}
+
+// Verifies reports whether generated PNGs are checked by decoding them.
+func (g *Generator) Verifies() bool {
+	return g.verify
+}
+
 func (g *Generator) Generate(content string) ([]byte, error) {
-	if content == "" {
-		return nil, fmt.Errorf("content cannot be empty")
+	return g.GeneratePNG(content, Options{Size: g.size})
+}
+
+func (g *Generator) GenerateWithSize(content string, size int) ([]byte, error) {
+	return g.GeneratePNG(content, Options{Size: size})
+}
+
+// GeneratePNG renders content as a PNG image.
+func (g *Generator) GeneratePNG(content string, opts Options) ([]byte, error) {
+	l, err := prepare(content, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	png, err := qr.Encode(content, RecoveryLevel, g.size)
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, renderImage(l)); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+
+	if g.verify {
+		if err := Verify(buf.Bytes(), content); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GenerateSVG renders content as a scalable SVG document.
+func (g *Generator) GenerateSVG(content string, opts Options) ([]byte, error) {
+	l, err := prepare(content, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate qr code: %w", err)
+		return nil, err
 	}
 
-	return png, nil
+	return renderSVG(l)
 }
 
-func (g *Generator) GenerateWithSize(content string, size int) ([]byte, error) {
+// GeneratePDF renders content as a single-page vector PDF.
+func (g *Generator) GeneratePDF(content string, opts Options) ([]byte, error) {
+	l, err := prepare(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderPDF(l)
+}
+
+// IsOptionError reports whether err was caused by render options that can
+// never produce a scannable symbol, as opposed to an internal failure.
+func IsOptionError(err error) bool {
+	return errors.Is(err, ErrLowContrast) || errors.Is(err, ErrLogoTooLarge) || errors.Is(err, errInvalidLogo)
+}
+
+// layout is an encoded symbol ready for a renderer.
+type layout struct {
+	bitmap [][]bool
+	opts   Options
+	// logoOrigin and logoSide locate the cleared logo box, in modules from the
+	// top-left of the symbol. logoSide is zero when there is no logo.
+	logoOrigin int
+	logoSide   int
+}
+
+func prepare(content string, opts Options) (*layout, error) {
 	if content == "" {
 		return nil, fmt.Errorf("content cannot be empty")
 	}
+	opts = opts.withDefaults()
+	if err := checkContrast(opts.Foreground, opts.Background); err != nil {
+		return nil, err
+	}
+
+	bitmap, err := symbol(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
 
-	if size <= 0 {
-		size = DefaultSize
+	l := &layout{bitmap: bitmap, opts: opts}
+	if opts.SwissQRBill {
+		if opts.Logo != nil {
+			return nil, fmt.Errorf("%w: Swiss QR-bills cannot carry a logo", errInvalidLogo)
+		}
+		l.opts.QuietZone = swissQuietZone(len(bitmap))
+	}
+	if opts.Logo != nil {
+		if err := checkLogo(len(bitmap), opts.LogoPercent, opts.Level); err != nil {
+			return nil, err
+		}
+		l.bitmap, l.logoOrigin, l.logoSide = clearLogoArea(bitmap, opts.LogoPercent)
 	}
+	return l, nil
+}
 
-	png, err := qr.Encode(content, RecoveryLevel, size)
+// symbol encodes content and returns its module bitmap without the quiet
+// zone, so renderers can apply their own margin.
+func symbol(content string, level Level) ([][]bool, error) {
+	q, err := qr.New(content, level.recovery())
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate qr code: %w", err)
 	}
-
-	return png, nil
+	q.DisableBorder = true
+	return q.Bitmap(), nil
 }
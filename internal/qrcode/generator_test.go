@@ -2,6 +2,12 @@ package qrcode
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"testing"
 )
 
@@ -75,3 +81,464 @@ func TestGeneratorLongContent(t *testing.T) {
 		t.Error("Expected non-empty PNG data")
 	}
 }
+
+func TestGenerateSVG(t *testing.T) {
+	g := New()
+
+	svg, err := g.GenerateSVG("https://example.com", DefaultOptions())
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if !bytes.Contains(svg, []byte("<svg")) {
+		t.Error("Expected SVG document")
+	}
+	if n := bytes.Count(svg, []byte("<path")); n != 1 {
+		t.Errorf("Expected exactly one path, got %d", n)
+	}
+
+	// Quiet zone and module size drive the document dimensions: a version 2
+	// symbol is 25 modules wide, plus two margins of 2 modules at 10 units each.
+	svg, err = g.GenerateSVG("https://example.com", Options{ModuleSize: 10, QuietZone: 2})
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if !bytes.Contains(svg, []byte(`width="290"`)) || !bytes.Contains(svg, []byte(`viewBox="0 0 29 29"`)) {
+		t.Errorf("Unexpected SVG dimensions: %s", svg[:200])
+	}
+
+	_, err = g.GenerateSVG("", DefaultOptions())
+	if err == nil {
+		t.Error("Expected error for empty content")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{"", DefaultLevel, false},
+		{"L", LevelLow, false},
+		{"m", LevelMedium, false},
+		{" Q ", LevelQuartile, false},
+		{"H", LevelHigh, false},
+		{"X", "", true},
+		{"Medium", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLevelDensity(t *testing.T) {
+	content := "https://example.com/some/path?with=query"
+
+	low, err := symbol(content, LevelLow)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	high, err := symbol(content, LevelHigh)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if len(high) <= len(low) {
+		t.Errorf("Expected level H symbol (%d modules) to be larger than level L (%d modules)", len(high), len(low))
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"#000000", "#000000", false},
+		{"#1E90FF", "#1e90ff", false},
+		{"#abc", "#aabbcc", false},
+		{"transparent", Transparent, false},
+		{"red", "", true},
+		{"#12345", "", true},
+		{"#gggggg", "", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseColor(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseColor(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && FormatColor(c) != tt.want {
+			t.Errorf("ParseColor(%q) = %s, want %s", tt.in, FormatColor(c), tt.want)
+		}
+	}
+}
+
+func TestGenerateColors(t *testing.T) {
+	g := New()
+	navy, _ := ParseColor("#001f5b")
+	gold, _ := ParseColor("#ffd700")
+	yellow, _ := ParseColor("#ffff66")
+
+	// Brand colours
+	data, err := g.GeneratePNG("https://example.com", Options{Foreground: navy, Background: gold})
+	if err != nil {
+		t.Fatalf("Failed to generate coloured QR code: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if got := FormatColor(img.At(0, 0)); got != "#ffd700" {
+		t.Errorf("Expected background #ffd700 in corner, got %s", got)
+	}
+
+	// Transparent background
+	data, err = g.GeneratePNG("https://example.com", Options{Background: color.Transparent})
+	if err != nil {
+		t.Fatalf("Failed to generate transparent QR code: %v", err)
+	}
+	img, err = png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Expected transparent corner, got alpha %d", a)
+	}
+
+	svg, err := g.GenerateSVG("https://example.com", Options{Foreground: navy, Background: color.Transparent})
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if bytes.Contains(svg, []byte("<rect")) || !bytes.Contains(svg, []byte(`fill="#001f5b"`)) {
+		t.Errorf("Unexpected transparent SVG: %s", svg)
+	}
+
+	// Low contrast and inverted combinations are rejected
+	for _, o := range []Options{
+		{Foreground: yellow, Background: DefaultBackground},
+		{Foreground: DefaultBackground, Background: DefaultForeground},
+		{Foreground: color.Transparent},
+	} {
+		if _, err := g.GeneratePNG("test", o); !errors.Is(err, ErrLowContrast) {
+			t.Errorf("Expected ErrLowContrast for %v on %v, got %v", o.Foreground, o.Background, err)
+		}
+	}
+}
+
+func TestGenerateLogo(t *testing.T) {
+	g := New()
+	red := color.RGBA{R: 0xff, A: 0xff}
+	logo := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	draw.Draw(logo, logo.Bounds(), &image.Uniform{C: red}, image.Point{}, draw.Src)
+
+	opts := Options{Size: 512, Level: LevelLow, Logo: logo}
+	if got := opts.EffectiveLevel(); got != LevelHigh {
+		t.Errorf("Expected logo to force level H, got %s", got)
+	}
+
+	data, err := g.GeneratePNG("https://example.com", opts)
+	if err != nil {
+		t.Fatalf("Failed to generate QR code with logo: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if got := FormatColor(img.At(256, 256)); got != "#ff0000" {
+		t.Errorf("Expected logo colour at centre, got %s", got)
+	}
+
+	svg, err := g.GenerateSVG("https://example.com", opts)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG with logo: %v", err)
+	}
+	if !bytes.Contains(svg, []byte("data:image/png;base64,")) {
+		t.Error("Expected embedded logo in SVG")
+	}
+
+	opts.LogoPercent = MaxLogoPercent + 1
+	if _, err := g.GeneratePNG("https://example.com", opts); !IsOptionError(err) {
+		t.Errorf("Expected option error for oversized logo percent, got %v", err)
+	}
+}
+
+func TestCheckLogo(t *testing.T) {
+	tests := []struct {
+		n, percent int
+		level      Level
+		wantErr    bool
+	}{
+		{25, DefaultLogoPercent, LevelHigh, false},
+		{57, 12, LevelHigh, false},
+		{21, MaxLogoPercent, LevelHigh, true}, // rounding up to whole modules hides 18%
+		{57, DefaultLogoPercent, LevelLow, true},
+		{25, MinLogoPercent - 1, LevelHigh, true},
+	}
+	for _, tt := range tests {
+		err := checkLogo(tt.n, tt.percent, tt.level)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkLogo(%d, %d, %s) error = %v, wantErr %v", tt.n, tt.percent, tt.level, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDecodeLogo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	if _, format, err := DecodeLogo(buf.Bytes()); err != nil || format != "png" {
+		t.Errorf("Expected PNG logo to decode, got %q, %v", format, err)
+	}
+	if _, _, err := DecodeLogo([]byte("<svg></svg>")); err == nil {
+		t.Error("Expected error for non-image logo")
+	}
+}
+
+func TestUnverified(t *testing.T) {
+	g := New()
+	g.SetVerify(true)
+	if g.Unverified().Verifies() {
+		t.Error("Expected the copy not to verify")
+	}
+	if !g.Verifies() {
+		t.Error("Expected the original to still verify")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	g := New()
+	g.SetVerify(true)
+
+	navy, _ := ParseColor("#001f5b")
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(logo, logo.Bounds(), &image.Uniform{C: color.RGBA{R: 0xcc, A: 0xff}}, image.Point{}, draw.Src)
+
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+	}{
+		{"default", "https://example.com", Options{}},
+		{"unicode", "Grüße aus Zürich ✓", Options{}},
+		{"level L small", "https://example.com/a/long/path?query=string&more=values", Options{Size: 128, Level: LevelLow}},
+		{"colours", "https://example.com", Options{Foreground: navy, Background: DefaultBackground}},
+		{"transparent", "https://example.com", Options{Background: color.Transparent}},
+		{"no quiet zone", "https://example.com", Options{QuietZone: 0}},
+		{"logo", "https://example.com/with/a/logo", Options{Size: 512, Logo: logo}},
+		{"large logo", "https://example.com/with/a/bigger/logo/and/more/data", Options{Size: 768, Logo: logo, LogoPercent: 13}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := g.GeneratePNG(tt.content, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to generate verified QR code: %v", err)
+			}
+			decoded, err := Decode(data)
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if decoded != tt.content {
+				t.Errorf("Decoded %q, want %q", decoded, tt.content)
+			}
+		})
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	data, err := New().Generate("https://example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate QR code: %v", err)
+	}
+
+	if err := Verify(data, "https://example.org"); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("Expected ErrVerificationFailed, got %v", err)
+	}
+
+	var blank bytes.Buffer
+	if err := png.Encode(&blank, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if err := Verify(blank.Bytes(), "anything"); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("Expected ErrVerificationFailed for blank image, got %v", err)
+	}
+}
+
+func TestStyles(t *testing.T) {
+	g := New()
+	g.SetVerify(true)
+
+	if _, err := ParseStyle("Dots"); err != nil {
+		t.Errorf("Expected dots style to parse: %v", err)
+	}
+	if _, err := ParseStyle("hearts"); err == nil {
+		t.Error("Expected error for unknown style")
+	}
+
+	for _, size := range []int{256, 512} {
+		if _, err := g.GeneratePNG("https://example.com/dots", Options{Size: size, Style: StyleDots}); err != nil {
+			t.Errorf("Failed to generate verified dotted QR code at %dpx: %v", size, err)
+		}
+	}
+
+	svg, err := g.GenerateSVG("https://example.com/dots", Options{Style: StyleDots})
+	if err != nil {
+		t.Fatalf("Failed to generate dotted SVG: %v", err)
+	}
+	if n := bytes.Count(svg, []byte("<path")); n != 1 || !bytes.Contains(svg, []byte("a0.45 0.45")) {
+		t.Errorf("Expected a single path with arcs, got %d paths", n)
+	}
+}
+
+func TestSwissQRBill(t *testing.T) {
+	g := New()
+	g.SetVerify(true)
+	content := "SPC\r\n0200\r\n1\r\nCH4431999123000889012"
+	opts := Options{Size: 512, Level: LevelHigh, SwissQRBill: true}
+	if got := opts.EffectiveLevel(); got != LevelMedium {
+		t.Errorf("Expected QR-bill to force level M, got %s", got)
+	}
+
+	data, err := g.GeneratePNG(content, opts)
+	if err != nil {
+		t.Fatalf("Failed to generate verified QR-bill: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if got := FormatColor(img.At(256, 256)); got != "#ffffff" {
+		t.Errorf("Expected white cross at centre, got %s", got)
+	}
+
+	svg, err := g.GenerateSVG(content, opts)
+	if err != nil {
+		t.Fatalf("Failed to generate QR-bill SVG: %v", err)
+	}
+	if !bytes.Contains(svg, []byte(`mm" height="`)) {
+		t.Errorf("Expected SVG sized in millimetres, got %s", svg[:120])
+	}
+
+	// Custom and transparent colours give way to a black cross on white.
+	colored := opts
+	colored.Foreground = color.RGBA{R: 0x00, G: 0x00, B: 0x80, A: 0xff}
+	colored.Background = color.Transparent
+	svg, err = g.GenerateSVG(content, colored)
+	if err != nil {
+		t.Fatalf("Failed to generate QR-bill SVG: %v", err)
+	}
+	if bytes.Contains(svg, []byte("transparent")) || bytes.Contains(svg, []byte("#000080")) ||
+		!bytes.Contains(svg, []byte(`fill="#ffffff"/>`)) || !bytes.Contains(svg, []byte(`fill="#000000"/>`)) {
+		t.Errorf("Expected a black on white QR-bill SVG, got %s", svg[bytes.Index(svg, []byte("<path")):][:80])
+	}
+	data, err = g.GeneratePNG(content, colored)
+	if err != nil {
+		t.Fatalf("Failed to generate QR-bill PNG: %v", err)
+	}
+	if img, _ := png.Decode(bytes.NewReader(data)); FormatColor(img.At(0, 0)) != "#ffffff" || FormatColor(img.At(256, 256)) != "#ffffff" {
+		t.Errorf("Expected a white quiet zone and cross, got %s %s", FormatColor(img.At(0, 0)), FormatColor(img.At(256, 256)))
+	}
+
+	opts.Logo = image.NewRGBA(image.Rect(0, 0, 8, 8))
+	if _, err := g.GeneratePNG(content, opts); !IsOptionError(err) {
+		t.Errorf("Expected option error for QR-bill with logo, got %v", err)
+	}
+}
+
+func TestGeneratePDF(t *testing.T) {
+	g := New()
+	logo := image.NewRGBA(image.Rect(0, 0, 16, 16))
+
+	for _, opts := range []Options{
+		{},
+		{Style: StyleDots, Background: color.Transparent},
+		{Logo: logo},
+		{SwissQRBill: true},
+	} {
+		data, err := g.GeneratePDF("https://example.com", opts)
+		if err != nil {
+			t.Fatalf("Failed to generate PDF: %v", err)
+		}
+		if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+			t.Fatal("Expected a complete PDF 1.4 document")
+		}
+		checkXref(t, data)
+	}
+
+	// The page is the 46 mm symbol plus at least 5 mm of quiet zone a side.
+	data, _ := g.GeneratePDF("https://example.com", Options{SwissQRBill: true})
+	var side float64
+	box := data[bytes.Index(data, []byte("/MediaBox")):]
+	if _, err := fmt.Sscanf(string(box), "/MediaBox [0 0 %f", &side); err != nil {
+		t.Fatalf("Failed to read MediaBox: %v", err)
+	}
+	if mm := side / pointsPerMM; mm < SwissSymbolMM+2*SwissQuietZoneMM || mm > SwissSymbolMM+2*SwissQuietZoneMM+5 {
+		t.Errorf("Expected QR-bill page of about 56mm, got %.2fmm", mm)
+	}
+}
+
+// checkXref asserts that every cross-reference entry points at the start of
+// its object and that startxref points at the table.
+func checkXref(t *testing.T, data []byte) {
+	t.Helper()
+	var start int
+	tail := data[bytes.LastIndex(data, []byte("startxref\n")):]
+	if _, err := fmt.Sscanf(string(tail), "startxref\n%d", &start); err != nil {
+		t.Fatalf("Failed to read startxref: %v", err)
+	}
+	if !bytes.HasPrefix(data[start:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", start)
+	}
+
+	var first, count int
+	table := data[start+len("xref\n"):]
+	if _, err := fmt.Sscanf(string(table), "%d %d\n", &first, &count); err != nil {
+		t.Fatalf("Failed to read xref header: %v", err)
+	}
+	entries := table[bytes.IndexByte(table, '\n')+1:]
+	for i := 1; i < count; i++ {
+		entry := string(entries[i*20 : i*20+20])
+		var offset int
+		if _, err := fmt.Sscanf(entry, "%d", &offset); err != nil {
+			t.Fatalf("Failed to read xref entry %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i, data[offset:offset+10])
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(10)
+
+	c.Put("a", []byte("aaaa"))
+	c.Put("b", []byte("bbbb"))
+	if data, ok := c.Get("a"); !ok || string(data) != "aaaa" {
+		t.Errorf("Expected cached a, got %q %v", data, ok)
+	}
+
+	// Adding c exceeds the budget; b is least recently used.
+	c.Put("c", []byte("cccc"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected a to survive eviction")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+
+	c.Put("huge", make([]byte, 11))
+	if _, ok := c.Get("huge"); ok {
+		t.Error("Expected oversized entry not to be cached")
+	}
+}
@@ -0,0 +1,177 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // register JPEG for DecodeLogo
+	"image/png"
+	"math"
+)
+
+// Logo size bounds, as a percentage of the symbol area (quiet zone excluded).
+const (
+	DefaultLogoPercent = 10
+	MinLogoPercent     = 4
+	MaxLogoPercent     = 15
+)
+
+// MaxLogoBytes bounds the size of an uploaded logo file.
+const MaxLogoBytes = 1 << 20
+
+// maxLogoDimension bounds the pixel width and height of an uploaded logo.
+const maxLogoDimension = 2048
+
+// ErrLogoTooLarge is returned when a logo would hide more modules than the
+// error correction level can rebuild.
+var ErrLogoTooLarge = errors.New("logo covers more of the symbol than error correction can recover")
+
+// errInvalidLogo marks logo settings that are out of bounds.
+var errInvalidLogo = errors.New("invalid logo")
+
+// logoTolerance is the share of symbol modules a logo may hide at each level.
+// It sits well below the nominal recovery capacity: the box cuts through
+// codewords at its edges, function patterns cannot be rebuilt, and a real
+// print picks up damage of its own. This is only a first gate; round-trip
+// verification is what proves a particular symbol still scans.
+var logoTolerance = map[Level]float64{
+	LevelLow:      0.03,
+	LevelMedium:   0.07,
+	LevelQuartile: 0.11,
+	LevelHigh:     0.15,
+}
+
+// DecodeLogo decodes an uploaded PNG or JPEG and returns the image along with
+// its format name.
+func DecodeLogo(data []byte) (image.Image, string, error) {
+	if len(data) > MaxLogoBytes {
+		return nil, "", fmt.Errorf("logo exceeds %d bytes", MaxLogoBytes)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("logo must be a PNG or JPEG image")
+	}
+	if format != "png" && format != "jpeg" {
+		return nil, "", fmt.Errorf("logo must be a PNG or JPEG image")
+	}
+	if cfg.Width > maxLogoDimension || cfg.Height > maxLogoDimension {
+		return nil, "", fmt.Errorf("logo must be at most %dx%d pixels", maxLogoDimension, maxLogoDimension)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode logo: %w", err)
+	}
+	return img, format, nil
+}
+
+// logoBox returns the side length, in modules, of the square cleared for a
+// logo in a symbol n modules wide. The side shares n's parity so the box sits
+// exactly on the centre module.
+func logoBox(n, percent int) int {
+	side := int(math.Ceil(float64(n) * math.Sqrt(float64(percent)/100)))
+	if side%2 != n%2 {
+		side++
+	}
+	return side
+}
+
+// checkLogo verifies that a logo of the given size fits the tolerance of level.
+func checkLogo(n, percent int, level Level) error {
+	if percent < MinLogoPercent || percent > MaxLogoPercent {
+		return fmt.Errorf("%w: size must be between %d%% and %d%% of the symbol", errInvalidLogo, MinLogoPercent, MaxLogoPercent)
+	}
+	side := logoBox(n, percent)
+	covered := float64(side*side) / float64(n*n)
+	if covered > logoTolerance[level] {
+		return fmt.Errorf("%w: %.0f%% hidden, level %s tolerates %.0f%%",
+			ErrLogoTooLarge, covered*100, level, logoTolerance[level]*100)
+	}
+	return nil
+}
+
+// clearLogoArea returns a copy of bitmap with the logo box set to light
+// modules, along with the box origin and side in modules.
+func clearLogoArea(bitmap [][]bool, percent int) (cleared [][]bool, origin, side int) {
+	n := len(bitmap)
+	side = logoBox(n, percent)
+	origin = (n - side) / 2
+
+	cleared = make([][]bool, n)
+	for y, row := range bitmap {
+		cleared[y] = append([]bool(nil), row...)
+		if y < origin || y >= origin+side {
+			continue
+		}
+		for x := origin; x < origin+side; x++ {
+			cleared[y][x] = false
+		}
+	}
+	return cleared, origin, side
+}
+
+// drawLogo scales logo to fit inside rect, keeping its aspect ratio, and
+// composites it over dst.
+func drawLogo(dst draw.Image, logo image.Image, rect image.Rectangle) {
+	lb := logo.Bounds()
+	if lb.Dx() == 0 || lb.Dy() == 0 || rect.Dx() <= 0 || rect.Dy() <= 0 {
+		return
+	}
+
+	scale := math.Min(float64(rect.Dx())/float64(lb.Dx()), float64(rect.Dy())/float64(lb.Dy()))
+	w := max(1, int(float64(lb.Dx())*scale))
+	h := max(1, int(float64(lb.Dy())*scale))
+	offset := image.Pt(rect.Min.X+(rect.Dx()-w)/2, rect.Min.Y+(rect.Dy()-h)/2)
+
+	scaled := scaleImage(logo, w, h)
+	draw.Draw(dst, scaled.Bounds().Add(offset), scaled, image.Point{}, draw.Over)
+}
+
+// scaleImage resizes src to w x h by averaging the source pixels under each
+// destination pixel. Logos are small, so this stays cheap without pulling in
+// an imaging library.
+func scaleImage(src image.Image, w, h int) *image.NRGBA {
+	sb := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sb.Dy()/h
+		y1 := max(y0+1, sb.Min.Y+(y+1)*sb.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sb.Dx()/w
+			x1 := max(x0+1, sb.Min.X+(x+1)*sb.Dx()/w)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R) * uint64(c.A)
+					g += uint64(c.G) * uint64(c.A)
+					b += uint64(c.B) * uint64(c.A)
+					a += uint64(c.A)
+					count++
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / a >> 8),
+				G: uint8(g / a >> 8),
+				B: uint8(b / a >> 8),
+				A: uint8(a / count >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// encodeLogoPNG re-encodes a logo for embedding in SVG output.
+func encodeLogoPNG(logo image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, logo); err != nil {
+		return nil, fmt.Errorf("failed to encode logo: %w", err)
+	}
+	return buf.Bytes(), nil
+}
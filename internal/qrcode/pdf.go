@@ -0,0 +1,211 @@
+package qrcode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+const (
+	// pointsPerMM converts millimetres to PDF points (1/72 inch).
+	pointsPerMM = 72 / 25.4
+	// pointsPerPixel matches SVG output, whose user units are CSS pixels
+	// of 1/96 inch.
+	pointsPerPixel = 72.0 / 96.0
+	// bezierCircle is the control point distance that approximates a
+	// quarter circle of unit radius with a cubic Bézier curve.
+	bezierCircle = 0.5523
+)
+
+// Object numbers in the documents written by writePDF.
+const (
+	pdfCatalog = iota + 1
+	pdfPages
+	pdfPage
+	pdfContents
+	pdfLogoImage
+	pdfLogoMask
+)
+
+// renderPDF draws a laid-out symbol as a single-page PDF 1.4 document built
+// from filled rectangles, with no fonts. The page is the symbol plus its quiet
+// zone. QR-bills are sized in millimetres; other symbols use ModuleSize as
+// CSS pixels, so the PDF prints at the same size as the SVG.
+func renderPDF(l *layout) ([]byte, error) {
+	opts := l.opts
+	n := len(l.bitmap)
+	total := n + 2*opts.QuietZone
+
+	unit := float64(opts.ModuleSize) * pointsPerPixel
+	if opts.SwissQRBill {
+		unit = SwissSymbolMM * pointsPerMM / float64(n)
+	}
+	page := float64(total) * unit
+
+	// PDF space has its origin at the bottom left; rect takes module
+	// coordinates from the top left of the page.
+	var content bytes.Buffer
+	rect := func(x, y, w, h float64) {
+		fmt.Fprintf(&content, "%.4f %.4f %.4f %.4f re\n", x*unit, page-(y+h)*unit, w*unit, h*unit)
+	}
+
+	if _, _, _, a := opts.Background.RGBA(); a != 0 {
+		content.WriteString(pdfColor(opts.Background))
+		rect(0, 0, float64(total), float64(total))
+		content.WriteString("f\n")
+	}
+
+	content.WriteString(pdfColor(opts.Foreground))
+	qz := opts.QuietZone
+	for y, row := range l.bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			if opts.Style.dotted(x, y, n) {
+				pdfCircle(&content, (float64(x+qz)+0.5)*unit, page-(float64(y+qz)+0.5)*unit, dotRadius*unit)
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] && !opts.Style.dotted(x, y, n) {
+				x++
+			}
+			rect(float64(start+qz), float64(y+qz), float64(x-start), 1)
+			x--
+		}
+	}
+	content.WriteString("f\n")
+
+	if opts.SwissQRBill {
+		origin, side := swissCrossBox(n)
+		origin += float64(qz)
+		for _, c := range swissCross {
+			fill := opts.Background
+			if c.dark {
+				fill = opts.Foreground
+			}
+			content.WriteString(pdfColor(fill))
+			rect(origin+c.x*side, origin+c.y*side, c.w*side, c.h*side)
+			content.WriteString("f\n")
+		}
+	}
+
+	var images [][]byte
+	if opts.Logo != nil {
+		// Half a module of clear space around the logo, as in PNG output.
+		lo := float64(l.logoOrigin+qz) + 0.5
+		side := float64(l.logoSide - 1)
+		logo, err := pdfImage(opts.Logo, side*unit, pdfLogoMask)
+		if err != nil {
+			return nil, err
+		}
+		images = logo
+		fmt.Fprintf(&content, "q %.4f 0 0 %.4f %.4f %.4f cm /Logo Do Q\n",
+			side*unit, side*unit, lo*unit, page-(lo+side)*unit)
+	}
+
+	return writePDF(page, content.Bytes(), images), nil
+}
+
+// pdfColor returns the operator that sets c as the fill colour. Transparent
+// colours, which can only be a background, are drawn as white.
+func pdfColor(c color.Color) string {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		r, g, b, _ = DefaultBackground.RGBA()
+	}
+	return fmt.Sprintf("%.3f %.3f %.3f rg\n", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+}
+
+// pdfCircle appends a closed circle path of radius r centred on (cx, cy).
+func pdfCircle(buf *bytes.Buffer, cx, cy, r float64) {
+	k := r * bezierCircle
+	fmt.Fprintf(buf, "%.4f %.4f m\n", cx+r, cy)
+	fmt.Fprintf(buf, "%.4f %.4f %.4f %.4f %.4f %.4f c\n", cx+r, cy+k, cx+k, cy+r, cx, cy+r)
+	fmt.Fprintf(buf, "%.4f %.4f %.4f %.4f %.4f %.4f c\n", cx-k, cy+r, cx-r, cy+k, cx-r, cy)
+	fmt.Fprintf(buf, "%.4f %.4f %.4f %.4f %.4f %.4f c\n", cx-r, cy-k, cx-k, cy-r, cx, cy-r)
+	fmt.Fprintf(buf, "%.4f %.4f %.4f %.4f %.4f %.4f c\n", cx+k, cy-r, cx+r, cy-k, cx+r, cy)
+	buf.WriteString("h\n")
+}
+
+// pdfImage returns the logo as two PDF objects: an RGB image and its alpha
+// soft mask, which must be written as object maskRef. The logo is scaled to
+// fit a square of side points at 300 DPI, keeping its aspect ratio by padding
+// with transparency.
+func pdfImage(logo image.Image, side float64, maskRef int) ([][]byte, error) {
+	px := max(1, int(side/72*300))
+	canvas := image.NewNRGBA(image.Rect(0, 0, px, px))
+	drawLogo(canvas, logo, canvas.Bounds())
+
+	rgb := make([]byte, 0, px*px*3)
+	alpha := make([]byte, 0, px*px)
+	for i := 0; i < len(canvas.Pix); i += 4 {
+		rgb = append(rgb, canvas.Pix[i], canvas.Pix[i+1], canvas.Pix[i+2])
+		alpha = append(alpha, canvas.Pix[i+3])
+	}
+
+	var objects [][]byte
+	for _, plane := range []struct {
+		data  []byte
+		space string
+		extra string
+	}{
+		{rgb, "/DeviceRGB", fmt.Sprintf(" /SMask %d 0 R", maskRef)},
+		{alpha, "/DeviceGray", ""},
+	} {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		if _, err := w.Write(plane.data); err != nil {
+			return nil, fmt.Errorf("failed to compress logo: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress logo: %w", err)
+		}
+
+		var obj bytes.Buffer
+		fmt.Fprintf(&obj, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode /Length %d%s >>\nstream\n",
+			px, px, plane.space, compressed.Len(), plane.extra)
+		obj.Write(compressed.Bytes())
+		obj.WriteString("\nendstream")
+		objects = append(objects, obj.Bytes())
+	}
+	return objects, nil
+}
+
+// writePDF assembles a one-page document of side points square from a
+// content stream and, optionally, the logo image and mask objects.
+func writePDF(side float64, content []byte, logo [][]byte) []byte {
+	resources := "<< >>"
+	if logo != nil {
+		resources = fmt.Sprintf("<< /XObject << /Logo %d 0 R >> >>", pdfLogoImage)
+	}
+	objects := []string{
+		fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPages),
+		fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", pdfPage),
+		fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.4f %.4f] /Resources %s /Contents %d 0 R >>",
+			pdfPages, side, side, resources, pdfContents),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+	if logo != nil {
+		objects = append(objects, string(logo[0]), string(logo[1]))
+	}
+
+	var buf bytes.Buffer
+	// The binary comment marks the file as binary for transfer tools.
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, pdfCatalog, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,69 @@
+package qrcode
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// renderImage rasterises a laid-out symbol at opts.Size pixels square. Every
+// module is drawn with the same whole number of pixels so edges stay crisp;
+// any remainder is split evenly into the margin.
+func renderImage(l *layout) image.Image {
+	opts := l.opts
+	total := len(l.bitmap) + 2*opts.QuietZone
+	ppm := max(1, opts.Size/total)
+	size := max(opts.Size, total*ppm)
+	offset := (size-total*ppm)/2 + opts.QuietZone*ppm
+	bounds := image.Rect(0, 0, size, size)
+
+	// Plain symbols only need two colours; a palette keeps the PNG small.
+	var img draw.Image
+	if opts.Logo == nil {
+		img = image.NewPaletted(bounds, color.Palette{opts.Background, opts.Foreground})
+	} else {
+		img = image.NewNRGBA(bounds)
+		draw.Draw(img, bounds, &image.Uniform{C: opts.Background}, image.Point{}, draw.Src)
+	}
+
+	fg := &image.Uniform{C: opts.Foreground}
+	dot := dotMask(ppm)
+	n := len(l.bitmap)
+	for y, row := range l.bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			r := image.Rect(x*ppm, y*ppm, (x+1)*ppm, (y+1)*ppm).Add(image.Pt(offset, offset))
+			if opts.Style.dotted(x, y, n) {
+				draw.DrawMask(img, r, fg, image.Point{}, dot, image.Point{}, draw.Over)
+			} else {
+				draw.Draw(img, r, fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if opts.SwissQRBill {
+		origin, side := swissCrossBox(n)
+		px := func(v float64) int { return offset + int(math.Round(v*float64(ppm))) }
+		bg := &image.Uniform{C: opts.Background}
+		for _, c := range swissCross {
+			r := image.Rect(px(origin+c.x*side), px(origin+c.y*side), px(origin+(c.x+c.w)*side), px(origin+(c.y+c.h)*side))
+			if c.dark {
+				draw.Draw(img, r, fg, image.Point{}, draw.Src)
+			} else {
+				draw.Draw(img, r, bg, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if opts.Logo != nil {
+		// Leave half a module of clear space between the logo and the symbol.
+		lo := offset + l.logoOrigin*ppm + ppm/2
+		hi := offset + (l.logoOrigin+l.logoSide)*ppm - ppm/2
+		drawLogo(img, opts.Logo, image.Rect(lo, lo, hi, hi))
+	}
+
+	return img
+}
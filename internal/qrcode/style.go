@@ -0,0 +1,62 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Style is the shape used to draw dark modules.
+type Style string
+
+const (
+	StyleSquare  Style = "square"
+	StyleDots    Style = "dots"
+	DefaultStyle       = StyleSquare
+)
+
+// dotRadius is the radius of a dot as a fraction of the module size. Leaving
+// a gap between neighbours is what makes the style recognisable, but much
+// smaller dots start to fail binarisation on phone cameras.
+const dotRadius = 0.45
+
+// ParseStyle parses a style name (case-insensitive). An empty string yields
+// DefaultStyle.
+func ParseStyle(s string) (Style, error) {
+	switch st := Style(strings.ToLower(strings.TrimSpace(s))); st {
+	case "":
+		return DefaultStyle, nil
+	case StyleSquare, StyleDots:
+		return st, nil
+	default:
+		return "", fmt.Errorf("invalid style %q", s)
+	}
+}
+
+// dotted reports whether the module at (x, y) in a symbol n modules wide is
+// drawn as a dot. The three finder patterns always stay square so scanners
+// can still lock on to the symbol.
+func (s Style) dotted(x, y, n int) bool {
+	if s != StyleDots {
+		return false
+	}
+	inFinder := (x < 7 && y < 7) || (x >= n-7 && y < 7) || (x < 7 && y >= n-7)
+	return !inFinder
+}
+
+// dotMask returns a size x size mask with an opaque disc in the middle.
+func dotMask(size int) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, size, size))
+	c := float64(size) / 2
+	r := dotRadius * float64(size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)+0.5-c, float64(y)+0.5-c
+			if dx*dx+dy*dy <= r*r {
+				mask.SetAlpha(x, y, color.Alpha{A: 0xff})
+			}
+		}
+	}
+	return mask
+}
@@ -0,0 +1,82 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+// renderSVG draws a laid-out symbol as a single SVG path. Horizontal runs of
+// square modules are merged so the path stays small even for large symbols.
+func renderSVG(l *layout) ([]byte, error) {
+	opts := l.opts
+	total := len(l.bitmap) + 2*opts.QuietZone
+	px := total * opts.ModuleSize
+
+	n := len(l.bitmap)
+	var path bytes.Buffer
+	for y, row := range l.bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			if opts.Style.dotted(x, y, n) {
+				// A full circle as two half arcs.
+				cx, cy := float64(x+opts.QuietZone)+0.5, float64(y+opts.QuietZone)+0.5
+				fmt.Fprintf(&path, "M%g %ga%g %g 0 1 0 %g 0a%g %g 0 1 0 %g 0z",
+					cx-dotRadius, cy, dotRadius, dotRadius, 2*dotRadius, dotRadius, dotRadius, -2*dotRadius)
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] && !opts.Style.dotted(x, y, n) {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+opts.QuietZone, y+opts.QuietZone, x-start, x-start)
+			x--
+		}
+	}
+
+	// QR-bills are printed at a fixed physical size; everything else is
+	// sized in pixels.
+	width := strconv.Itoa(px)
+	if opts.SwissQRBill {
+		width = strconv.FormatFloat(SwissSymbolMM*float64(total)/float64(n), 'f', 3, 64) + "mm"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		width, width, total, total)
+	if bg := FormatColor(opts.Background); bg != Transparent {
+		fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, total, total, bg)
+	}
+	fmt.Fprintf(&buf, `<path d="%s" fill="%s"/>`, path.String(), FormatColor(opts.Foreground))
+
+	if opts.SwissQRBill {
+		origin, side := swissCrossBox(n)
+		origin += float64(opts.QuietZone)
+		for _, c := range swissCross {
+			fill := opts.Background
+			if c.dark {
+				fill = opts.Foreground
+			}
+			fmt.Fprintf(&buf, `<rect x="%.4f" y="%.4f" width="%.4f" height="%.4f" fill="%s"/>`,
+				origin+c.x*side, origin+c.y*side, c.w*side, c.h*side, FormatColor(fill))
+		}
+	}
+
+	if opts.Logo != nil {
+		logo, err := encodeLogoPNG(opts.Logo)
+		if err != nil {
+			return nil, err
+		}
+		// Half a module of clear space around the logo, as in PNG output.
+		fmt.Fprintf(&buf, `<image x="%g" y="%g" width="%d" height="%d" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`,
+			float64(l.logoOrigin+opts.QuietZone)+0.5, float64(l.logoOrigin+opts.QuietZone)+0.5,
+			l.logoSide-1, l.logoSide-1, base64.StdEncoding.EncodeToString(logo))
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package qrcode
+
+import (
+	"math"
+)
+
+// Swiss QR-bill dimensions in millimetres, as set by the Swiss Implementation
+// Guidelines for the QR-bill.
+const (
+	SwissSymbolMM    = 46.0
+	SwissQuietZoneMM = 5.0
+	SwissCrossMM     = 7.0
+)
+
+// swissCrossBorderMM is the light frame that separates the cross from the
+// surrounding modules.
+const swissCrossBorderMM = 0.5
+
+// crossRect is one rectangle of the Swiss cross, in units of the cross side.
+// Dark rectangles take the foreground colour, light ones the background.
+type crossRect struct {
+	x, y, w, h float64
+	dark       bool
+}
+
+// swissCross lists the rectangles of the cross in drawing order: the light
+// frame, the dark square, then the two bars of the light cross, which follow
+// the flag's proportions of arms 6 wide and 20 long on a field of 32.
+var swissCross = func() []crossRect {
+	border := swissCrossBorderMM / SwissCrossMM
+	field := 1 - 2*border
+	arm, bar := field*6/32, field*20/32
+	return []crossRect{
+		{x: 0, y: 0, w: 1, h: 1},
+		{x: border, y: border, w: field, h: field, dark: true},
+		{x: (1 - arm) / 2, y: (1 - bar) / 2, w: arm, h: bar},
+		{x: (1 - bar) / 2, y: (1 - arm) / 2, w: bar, h: arm},
+	}
+}()
+
+// swissCrossBox returns the origin and side, in modules, of the cross centred
+// on a symbol n modules wide.
+func swissCrossBox(n int) (origin, side float64) {
+	side = float64(n) * SwissCrossMM / SwissSymbolMM
+	return (float64(n) - side) / 2, side
+}
+
+// swissQuietZone is the quiet zone, in whole modules, that is at least
+// SwissQuietZoneMM wide when the symbol is printed SwissSymbolMM wide.
+func swissQuietZone(n int) int {
+	return int(math.Ceil(SwissQuietZoneMM * float64(n) / SwissSymbolMM))
+}
@@ -0,0 +1,57 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/makiuchi-d/gozxing"
+	zxqr "github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ErrVerificationFailed is returned when a rendered image does not decode
+// back to the content it was generated from.
+var ErrVerificationFailed = errors.New("qr code did not decode to its content")
+
+// Decode reads the QR code in a PNG or JPEG image and returns its payload.
+// Transparent areas are flattened onto white first, matching how overlays are
+// expected to be printed.
+func Decode(data []byte) (string, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	flat := image.NewRGBA(src.Bounds())
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: DefaultBackground}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, src.Bounds().Min, draw.Over)
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(flat)
+	if err != nil {
+		return "", fmt.Errorf("failed to binarize image: %w", err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_CHARACTER_SET: "UTF-8",
+		gozxing.DecodeHintType_TRY_HARDER:    true,
+	}
+	result, err := zxqr.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		return "", fmt.Errorf("failed to read qr code: %w", err)
+	}
+	return result.GetText(), nil
+}
+
+// Verify decodes a rendered image and checks that it carries content.
+func Verify(data []byte, content string) error {
+	decoded, err := Decode(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if decoded != content {
+		return fmt.Errorf("%w: got %q", ErrVerificationFailed, decoded)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Link is the redirect behind a dynamic code. The code encodes the short URL
+// for Slug, and scans are sent on to Target, which can be changed at any time
+// without reprinting the code.
+type Link struct {
+	CodeID int64
+	Slug   string
+	Target string
+	LinkLimits
+	// ScanCount is the number of scans redirected to Target, which
+	// MaxScans limits.
+	ScanCount int
+	// PassphraseHash is the bcrypt hash of the passphrase scans must enter
+	// before being redirected, or empty for an open link.
+	PassphraseHash string
+	// Rules holds the redirect rules that pick a target other than Target
+	// for some scans, as JSON.
+	Rules     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LinkLimits restrict when a link redirects to its target. Outside them,
+// scans are sent to Fallback, or shown a notice if it is empty.
+type LinkLimits struct {
+	// StartsAt and ExpiresAt bound the validity window; nil leaves it open.
+	StartsAt  *time.Time
+	ExpiresAt *time.Time
+	// MaxScans is the number of scans redirected before the link is
+	// exhausted, or 0 for no limit.
+	MaxScans int
+	Fallback string
+}
+
+// LinkStatus says whether a link currently redirects to its target.
+type LinkStatus string
+
+const (
+	LinkActive    LinkStatus = "active"
+	LinkScheduled LinkStatus = "scheduled"
+	LinkExpired   LinkStatus = "expired"
+	LinkExhausted LinkStatus = "exhausted"
+)
+
+// ErrSlugTaken is returned when a new link's slug is already in use.
+var ErrSlugTaken = errors.New("slug is already in use")
+
+const linkColumns = "code_id, slug, target, starts_at, expires_at, max_scans, scan_count, fallback, passphrase_hash, rules, created_at, updated_at"
+
+// linkRow scans a row of linkColumns, whose window bounds may be NULL.
+type linkRow struct {
+	Link
+	startsAt, expiresAt sql.NullTime
+}
+
+func (r *linkRow) scanDest() []any {
+	return []any{&r.CodeID, &r.Slug, &r.Target, &r.startsAt, &r.expiresAt,
+		&r.MaxScans, &r.ScanCount, &r.Fallback, &r.PassphraseHash, &r.Rules, &r.CreatedAt, &r.UpdatedAt}
+}
+
+func (r *linkRow) link() *Link {
+	link := r.Link
+	if r.startsAt.Valid {
+		link.StartsAt = &r.startsAt.Time
+	}
+	if r.expiresAt.Valid {
+		link.ExpiresAt = &r.expiresAt.Time
+	}
+	return &link
+}
+
+// Status returns the state of the link at now.
+func (l *Link) Status(now time.Time) LinkStatus {
+	switch {
+	case l.StartsAt != nil && now.Before(*l.StartsAt):
+		return LinkScheduled
+	case l.ExpiresAt != nil && !now.Before(*l.ExpiresAt):
+		return LinkExpired
+	case l.MaxScans > 0 && l.ScanCount >= l.MaxScans:
+		return LinkExhausted
+	}
+	return LinkActive
+}
+
+// limitArgs returns the limits as column values, with open window bounds as
+// NULL and times in the layout SQLite compares as text.
+func (l *LinkLimits) limitArgs() []any {
+	bound := func(t *time.Time) any {
+		if t == nil {
+			return nil
+		}
+		return t.UTC().Format(scanTimeLayout)
+	}
+	return []any{bound(l.StartsAt), bound(l.ExpiresAt), l.MaxScans, l.Fallback}
+}
+
+// InsertDynamic stores a new code together with its link, whose CodeID is
+// filled in, and its tags. It returns ErrSlugTaken if another link has the
+// same slug.
+func (s *Store) InsertDynamic(qr *QRCode, link *Link, tags ...string) (_ *QRCode, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx, &err)
+
+	id, err := insertCode(tx, qr)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]any{id, link.Slug, link.Target, link.PassphraseHash, link.Rules}, link.limitArgs()...)
+	_, err = tx.Exec("INSERT INTO links (code_id, slug, target, passphrase_hash, rules, starts_at, expires_at, max_scans, fallback) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, fmt.Errorf("failed to insert link: %w", err)
+	}
+	if err := setCodeTags(tx, id, tags); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit dynamic code: %w", err)
+	}
+
+	link.CodeID = id
+	return s.GetByID(id)
+}
+
+// GetLink returns the link with the given slug, or nil if there is none.
+func (s *Store) GetLink(slug string) (*Link, error) {
+	return s.getLink("slug", slug)
+}
+
+// GetLinkByCode returns the link of a dynamic code, or nil for a static one.
+func (s *Store) GetLinkByCode(codeID int64) (*Link, error) {
+	return s.getLink("code_id", codeID)
+}
+
+func (s *Store) getLink(column string, value any) (*Link, error) {
+	var row linkRow
+	err := s.db.QueryRow("SELECT "+linkColumns+" FROM links WHERE "+column+" = ?", value).Scan(row.scanDest()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+	return row.link(), nil
+}
+
+// ListLinks returns the links of the given codes, keyed by code ID. Static
+// codes have no entry.
+func (s *Store) ListLinks(codeIDs []int64) (links map[int64]*Link, err error) {
+	links = make(map[int64]*Link)
+	if len(codeIDs) == 0 {
+		return links, nil
+	}
+
+	placeholders, args := inList(codeIDs)
+	rows, err := s.db.Query("SELECT "+linkColumns+" FROM links WHERE code_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var row linkRow
+		if err := rows.Scan(row.scanDest()...); err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+		links[row.CodeID] = row.link()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate links: %w", err)
+	}
+	return links, nil
+}
+
+// updateLink applies the column assignments in set to the link of a dynamic
+// code, returning ErrNotFound if the code has no link.
+func updateLink(db execer, codeID int64, set string, args ...any) error {
+	result, err := db.Exec(
+		"UPDATE links SET "+set+", updated_at = CURRENT_TIMESTAMP WHERE code_id = ?",
+		append(args, codeID)...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update link: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimScan counts a scan of a dynamic code against its limits and returns
+// LinkActive if it may be redirected to the target. The check and the count
+// are a single statement, so concurrent scans can never exceed MaxScans.
+// Otherwise the status says why the link is inactive.
+func (s *Store) ClaimScan(codeID int64, now time.Time) (LinkStatus, error) {
+	at := now.UTC().Format(scanTimeLayout)
+	result, err := s.db.Exec(`
+		UPDATE links SET scan_count = scan_count + 1
+		WHERE code_id = ?
+			AND (starts_at IS NULL OR starts_at <= ?)
+			AND (expires_at IS NULL OR expires_at > ?)
+			AND (max_scans = 0 OR scan_count < max_scans)`,
+		codeID, at, at,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to claim scan: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 1 {
+		return LinkActive, nil
+	}
+
+	link, err := s.GetLinkByCode(codeID)
+	if err != nil {
+		return "", err
+	}
+	if link == nil {
+		return "", ErrNotFound
+	}
+	// The update lost a race for the last scan, or the limits changed in
+	// between; either way this scan was not counted.
+	if status := link.Status(now); status != LinkActive {
+		return status, nil
+	}
+	return LinkExhausted, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
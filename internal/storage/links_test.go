@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreLinks(t *testing.T) {
+	store := newTestStore(t)
+
+	link := &Link{Slug: "abc1234", Target: "https://example.com/a"}
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/abc1234", ImageData: []byte("png")}, link)
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+	if link.CodeID != qr.ID {
+		t.Errorf("Expected link for code %d, got %d", qr.ID, link.CodeID)
+	}
+
+	got, err := store.GetLink("abc1234")
+	if err != nil || got == nil {
+		t.Fatalf("Failed to get link: %v", err)
+	}
+	if got.CodeID != qr.ID || got.Target != "https://example.com/a" {
+		t.Errorf("Unexpected link %+v", got)
+	}
+	if missing, err := store.GetLink("nope"); err != nil || missing != nil {
+		t.Errorf("Expected no link, got %+v %v", missing, err)
+	}
+
+	// A taken slug rolls back the code as well.
+	_, err = store.InsertDynamic(&QRCode{Content: "other", ImageData: []byte("png")}, &Link{Slug: "abc1234", Target: "https://example.com/b"})
+	if !errors.Is(err, ErrSlugTaken) {
+		t.Fatalf("Expected ErrSlugTaken, got %v", err)
+	}
+	if n, _ := store.Count(Filter{}); n != 1 {
+		t.Errorf("Expected the failed insert to leave 1 code, got %d", n)
+	}
+
+	target := "https://example.com/c"
+	if err := store.UpdateCode(qr, CodeChanges{Target: &target}); err != nil {
+		t.Fatalf("Failed to update target: %v", err)
+	}
+	if err := store.UpdateCode(&QRCode{ID: 99999}, CodeChanges{Target: &target}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	static, err := store.Create("static", "", []byte("png"))
+	if err != nil {
+		t.Fatalf("Failed to create code: %v", err)
+	}
+	links, err := store.ListLinks([]int64{qr.ID, static.ID})
+	if err != nil {
+		t.Fatalf("Failed to list links: %v", err)
+	}
+	if len(links) != 1 || links[qr.ID].Target != "https://example.com/c" {
+		t.Errorf("Expected only the updated dynamic link, got %+v", links)
+	}
+
+	// Deleting the code deletes its link.
+	if err := store.Delete(qr.ID); err != nil {
+		t.Fatalf("Failed to delete code: %v", err)
+	}
+	if got, err := store.GetLinkByCode(qr.ID); err != nil || got != nil {
+		t.Errorf("Expected link to be deleted, got %+v %v", got, err)
+	}
+}
+
+func TestStoreLinkLimits(t *testing.T) {
+	store := newTestStore(t)
+
+	start := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	link := &Link{Slug: "promo", Target: "https://example.com/sale", LinkLimits: LinkLimits{
+		StartsAt: &start, ExpiresAt: &end, MaxScans: 2, Fallback: "https://example.com/over",
+	}}
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/promo", ImageData: []byte("png")}, link)
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+
+	got, err := store.GetLink("promo")
+	if err != nil || got == nil {
+		t.Fatalf("Failed to get link: %v", err)
+	}
+	if !got.StartsAt.Equal(start) || !got.ExpiresAt.Equal(end) || got.MaxScans != 2 || got.Fallback != "https://example.com/over" {
+		t.Errorf("Unexpected limits %+v", got.LinkLimits)
+	}
+
+	claims := []struct {
+		at   time.Time
+		want LinkStatus
+	}{
+		{start.Add(-time.Minute), LinkScheduled},
+		{start, LinkActive},
+		{start.Add(time.Hour), LinkActive},
+		{start.Add(2 * time.Hour), LinkExhausted},
+		{end, LinkExpired},
+	}
+	for _, c := range claims {
+		status, err := store.ClaimScan(qr.ID, c.at)
+		if err != nil {
+			t.Fatalf("Failed to claim scan: %v", err)
+		}
+		if status != c.want {
+			t.Errorf("ClaimScan at %v = %s, want %s", c.at, status, c.want)
+		}
+	}
+	if got, _ := store.GetLinkByCode(qr.ID); got.ScanCount != 2 {
+		t.Errorf("Expected 2 counted scans, got %d", got.ScanCount)
+	}
+
+	// Raising the limit and opening the window reactivates the link.
+	if err := store.UpdateCode(qr, CodeChanges{Limits: &LinkLimits{MaxScans: 3}}); err != nil {
+		t.Fatalf("Failed to update limits: %v", err)
+	}
+	got, _ = store.GetLinkByCode(qr.ID)
+	if got.StartsAt != nil || got.ExpiresAt != nil || got.Fallback != "" || got.Status(end) != LinkActive {
+		t.Errorf("Expected open limits, got %+v", got.LinkLimits)
+	}
+	if err := store.UpdateCode(&QRCode{ID: 99999}, CodeChanges{Limits: &LinkLimits{}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.ClaimScan(99999, end); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreClaimScanConcurrent(t *testing.T) {
+	store := newTestStore(t)
+
+	const limit = 10
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/rush", ImageData: []byte("png")},
+		&Link{Slug: "rush", Target: "https://example.com", LinkLimits: LinkLimits{MaxScans: limit}})
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		active int
+	)
+	now := time.Now()
+	for i := 0; i < 5*limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := store.ClaimScan(qr.ID, now)
+			if err != nil {
+				t.Errorf("Failed to claim scan: %v", err)
+				return
+			}
+			if status == LinkActive {
+				mu.Lock()
+				active++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if active != limit {
+		t.Errorf("Expected exactly %d redirected scans, got %d", limit, active)
+	}
+}
+
+func TestStoreLinkPassphrase(t *testing.T) {
+	store := newTestStore(t)
+
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/locked", ImageData: []byte("png")},
+		&Link{Slug: "locked", Target: "https://example.com", PassphraseHash: "hash1"})
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+	if got, _ := store.GetLink("locked"); got.PassphraseHash != "hash1" {
+		t.Errorf("Expected hash1, got %q", got.PassphraseHash)
+	}
+
+	cleared := ""
+	if err := store.UpdateCode(qr, CodeChanges{PassphraseHash: &cleared}); err != nil {
+		t.Fatalf("Failed to clear passphrase: %v", err)
+	}
+	if got, _ := store.GetLink("locked"); got.PassphraseHash != "" {
+		t.Errorf("Expected no hash, got %q", got.PassphraseHash)
+	}
+	if err := store.UpdateCode(&QRCode{ID: 99999}, CodeChanges{PassphraseHash: &cleared}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreLinkRules(t *testing.T) {
+	store := newTestStore(t)
+
+	rules := `[{"name":"ios","platforms":["ios"],"target":"https://apps.example.com"}]`
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/rules", ImageData: []byte("png")},
+		&Link{Slug: "rules", Target: "https://example.com", Rules: rules})
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+	if got, _ := store.GetLink("rules"); got.Rules != rules {
+		t.Errorf("Expected rules %s, got %q", rules, got.Rules)
+	}
+
+	cleared := ""
+	if err := store.UpdateCode(qr, CodeChanges{Rules: &cleared}); err != nil {
+		t.Fatalf("Failed to clear rules: %v", err)
+	}
+	if got, _ := store.GetLinkByCode(qr.ID); got.Rules != "" {
+		t.Errorf("Expected no rules, got %q", got.Rules)
+	}
+	if err := store.UpdateCode(&QRCode{ID: 99999}, CodeChanges{Rules: &rules}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	now := time.Now()
+	for _, rule := range []string{"ios", "ios", "default"} {
+		if err := store.RecordRuleHit(qr.ID, rule, now); err != nil {
+			t.Fatalf("Failed to record rule hit: %v", err)
+		}
+	}
+	if err := store.RecordRuleHit(qr.ID, "ios", now.AddDate(0, 0, -2)); err != nil {
+		t.Fatalf("Failed to record rule hit: %v", err)
+	}
+	hits, err := store.RuleHits(qr.ID, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to count rule hits: %v", err)
+	}
+	if len(hits) != 2 || hits["ios"] != 2 || hits["default"] != 1 {
+		t.Errorf("Unexpected rule hits %v", hits)
+	}
+
+	// Deleting the code deletes its rule hits.
+	if err := store.Delete(qr.ID); err != nil {
+		t.Fatalf("Failed to delete code: %v", err)
+	}
+	if hits, err := store.RuleHits(qr.ID, time.Time{}); err != nil || len(hits) != 0 {
+		t.Errorf("Expected no rule hits after delete, got %v, %v", hits, err)
+	}
+}
+
+func TestStoreUpdateCode(t *testing.T) {
+	store := newTestStore(t)
+
+	link := &Link{Slug: "upd1234", Target: "https://example.com/a"}
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/upd1234", Label: "old", ImageData: []byte("png")}, link, "print")
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+
+	target, hash, tags := "https://example.com/b", "hash", []string{"spring"}
+	qr.Label = "new"
+	err = store.UpdateCode(qr, CodeChanges{
+		Target:         &target,
+		Limits:         &LinkLimits{MaxScans: 5},
+		PassphraseHash: &hash,
+		Tags:           &tags,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update code: %v", err)
+	}
+	got, _ := store.GetLinkByCode(qr.ID)
+	if got.Target != target || got.MaxScans != 5 || got.PassphraseHash != hash || got.Rules != "" {
+		t.Errorf("Unexpected link after update %+v", got)
+	}
+	if codeTags, _ := store.ListCodeTags([]int64{qr.ID}); len(codeTags[qr.ID]) != 1 || codeTags[qr.ID][0] != "spring" {
+		t.Errorf("Expected the tags to be replaced, got %v", codeTags)
+	}
+
+	// Link changes to a static code fail, and nothing else is applied.
+	static, err := store.Insert(&QRCode{Content: "static", Label: "old", ImageData: []byte("png")})
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+	static.Label = "new"
+	if err := store.UpdateCode(static, CodeChanges{Tags: &tags, Target: &target}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if got, _ := store.GetByID(static.ID); got.Label != "old" {
+		t.Errorf("Expected the label to be rolled back, got %q", got.Label)
+	}
+	if codeTags, _ := store.ListCodeTags([]int64{static.ID}); len(codeTags) != 0 {
+		t.Errorf("Expected the tags to be rolled back, got %v", codeTags)
+	}
+}
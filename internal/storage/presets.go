@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// UTMPreset is a named set of UTM tags that can be applied to new URL codes.
+type UTMPreset struct {
+	ID        int64
+	Name      string
+	Source    string
+	Medium    string
+	Campaign  string
+	Term      string
+	Content   string
+	CreatedAt time.Time
+}
+
+// ErrPresetExists is returned when a new preset's name is already in use.
+var ErrPresetExists = errors.New("preset name is already in use")
+
+// CreateUTMPreset stores a new preset and returns the saved row. It returns
+// ErrPresetExists if another preset has the same name.
+func (s *Store) CreateUTMPreset(p *UTMPreset) (*UTMPreset, error) {
+	result, err := s.db.Exec(
+		"INSERT INTO utm_presets (name, source, medium, campaign, term, content) VALUES (?, ?, ?, ?, ?, ?)",
+		p.Name, p.Source, p.Medium, p.Campaign, p.Term, p.Content,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrPresetExists
+		}
+		return nil, fmt.Errorf("failed to insert utm preset: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	saved := *p
+	saved.ID = id
+	err = s.db.QueryRow("SELECT created_at FROM utm_presets WHERE id = ?", id).Scan(&saved.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get utm preset: %w", err)
+	}
+	return &saved, nil
+}
+
+// ListUTMPresets returns all presets by name.
+func (s *Store) ListUTMPresets() (presets []*UTMPreset, err error) {
+	rows, err := s.db.Query("SELECT id, name, source, medium, campaign, term, content, created_at FROM utm_presets ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list utm presets: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		p := &UTMPreset{}
+		if err := rows.Scan(&p.ID, &p.Name, &p.Source, &p.Medium, &p.Campaign, &p.Term, &p.Content, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan utm preset: %w", err)
+		}
+		presets = append(presets, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate utm presets: %w", err)
+	}
+	return presets, nil
+}
+
+// DeleteUTMPreset removes a preset. Codes created from it keep their tags.
+func (s *Store) DeleteUTMPreset(id int64) error {
+	result, err := s.db.Exec("DELETE FROM utm_presets WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete utm preset: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreUTMPresets(t *testing.T) {
+	store := newTestStore(t)
+
+	saved, err := store.CreateUTMPreset(&UTMPreset{Name: "posters", Source: "poster", Medium: "print"})
+	if err != nil {
+		t.Fatalf("Failed to create preset: %v", err)
+	}
+	if saved.ID == 0 || saved.CreatedAt.IsZero() || saved.Medium != "print" {
+		t.Errorf("Unexpected preset %+v", saved)
+	}
+	if _, err := store.CreateUTMPreset(&UTMPreset{Name: "flyers", Source: "flyer", Medium: "print"}); err != nil {
+		t.Fatalf("Failed to create preset: %v", err)
+	}
+	if _, err := store.CreateUTMPreset(&UTMPreset{Name: "posters"}); !errors.Is(err, ErrPresetExists) {
+		t.Errorf("Expected ErrPresetExists, got %v", err)
+	}
+
+	presets, err := store.ListUTMPresets()
+	if err != nil {
+		t.Fatalf("Failed to list presets: %v", err)
+	}
+	if len(presets) != 2 || presets[0].Name != "flyers" || presets[1].Source != "poster" {
+		t.Errorf("Expected presets by name, got %+v", presets)
+	}
+
+	if err := store.DeleteUTMPreset(saved.ID); err != nil {
+		t.Fatalf("Failed to delete preset: %v", err)
+	}
+	if err := store.DeleteUTMPreset(saved.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if presets, _ := store.ListUTMPresets(); len(presets) != 1 {
+		t.Errorf("Expected 1 preset after delete, got %d", len(presets))
+	}
+}
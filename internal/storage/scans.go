@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scan is one hit on the redirect of a dynamic code. Client and Device are
+// coarse classes of the user agent, not the agent string itself; Referrer is
+// only a host name, and IPHash is empty unless IP hashing is enabled.
+type Scan struct {
+	CodeID    int64
+	ScannedAt time.Time
+	Client    string
+	Device    string
+	Referrer  string
+	IPHash    string
+}
+
+// DailyCount is the number of scans of a code on one UTC day.
+type DailyCount struct {
+	Day   time.Time
+	Count int
+}
+
+// ScanDimension is a scan attribute that counts can be broken down by.
+type ScanDimension string
+
+const (
+	ScanByClient   ScanDimension = "client"
+	ScanByDevice   ScanDimension = "device"
+	ScanByReferrer ScanDimension = "referrer"
+)
+
+// scanTimeLayout matches CURRENT_TIMESTAMP, so scan times sort and compare as
+// text and SQLite's date functions read them.
+const scanTimeLayout = "2006-01-02 15:04:05"
+
+// RecordScan stores a scan. A zero ScannedAt is taken as now.
+func (s *Store) RecordScan(scan *Scan) error {
+	at := scan.ScannedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	_, err := s.db.Exec(
+		"INSERT INTO scans (code_id, scanned_at, client, device, referrer, ip_hash) VALUES (?, ?, ?, ?, ?, ?)",
+		scan.CodeID, at.UTC().Format(scanTimeLayout), scan.Client, scan.Device, scan.Referrer, scan.IPHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record scan: %w", err)
+	}
+	return nil
+}
+
+// DailyScans returns the scans of a code per UTC day from since onwards, in
+// date order. Days without scans are left out.
+func (s *Store) DailyScans(codeID int64, since time.Time) (days []DailyCount, err error) {
+	rows, err := s.db.Query(
+		"SELECT date(scanned_at) AS day, COUNT(*) FROM scans WHERE code_id = ? AND scanned_at >= ? GROUP BY day ORDER BY day",
+		codeID, since.UTC().Format(scanTimeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count scans: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			day   string
+			count int
+		)
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan daily count: %w", err)
+		}
+		t, err := time.Parse(time.DateOnly, day)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse scan day %q: %w", day, err)
+		}
+		days = append(days, DailyCount{Day: t, Count: count})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate daily counts: %w", err)
+	}
+	return days, nil
+}
+
+// RecordRuleHit stores that a redirect of a dynamic code was decided by the
+// named rule.
+func (s *Store) RecordRuleHit(codeID int64, rule string, at time.Time) error {
+	_, err := s.db.Exec(
+		"INSERT INTO rule_hits (code_id, hit_at, rule) VALUES (?, ?, ?)",
+		codeID, at.UTC().Format(scanTimeLayout), rule,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record rule hit: %w", err)
+	}
+	return nil
+}
+
+// RuleHits returns the redirects of a code from since onwards, counted by
+// the rule that decided them.
+func (s *Store) RuleHits(codeID int64, since time.Time) (counts map[string]int, err error) {
+	rows, err := s.db.Query(
+		"SELECT rule, COUNT(*) FROM rule_hits WHERE code_id = ? AND hit_at >= ? GROUP BY rule",
+		codeID, since.UTC().Format(scanTimeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rule hits: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	counts = make(map[string]int)
+	for rows.Next() {
+		var (
+			rule  string
+			count int
+		)
+		if err := rows.Scan(&rule, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan rule hits: %w", err)
+		}
+		counts[rule] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rule hits: %w", err)
+	}
+	return counts, nil
+}
+
+// ScanCounts returns the scans of a code from since onwards, counted by the
+// values of dim.
+func (s *Store) ScanCounts(codeID int64, since time.Time, dim ScanDimension) (counts map[string]int, err error) {
+	switch dim {
+	case ScanByClient, ScanByDevice, ScanByReferrer:
+	default:
+		return nil, fmt.Errorf("unknown scan dimension %q", dim)
+	}
+
+	rows, err := s.db.Query(
+		"SELECT "+string(dim)+", COUNT(*) FROM scans WHERE code_id = ? AND scanned_at >= ? GROUP BY "+string(dim),
+		codeID, since.UTC().Format(scanTimeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count scans: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	counts = make(map[string]int)
+	for rows.Next() {
+		var (
+			value string
+			count int
+		)
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan count: %w", err)
+		}
+		counts[value] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate counts: %w", err)
+	}
+	return counts, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreScans(t *testing.T) {
+	store := newTestStore(t)
+
+	qr, err := store.InsertDynamic(&QRCode{Content: "https://qr.example/r/scans", ImageData: []byte("png")}, &Link{Slug: "scans", Target: "https://example.com"})
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, scan := range []Scan{
+		{ScannedAt: day.Add(-time.Hour), Client: "safari", Device: "mobile"}, // before since
+		{ScannedAt: day.Add(time.Hour), Client: "safari", Device: "mobile", Referrer: "example.org"},
+		{ScannedAt: day.Add(23 * time.Hour), Client: "chrome", Device: "mobile"},
+		{ScannedAt: day.AddDate(0, 0, 2), Client: "chrome", Device: "desktop", IPHash: "abc"},
+	} {
+		scan.CodeID = qr.ID
+		if err := store.RecordScan(&scan); err != nil {
+			t.Fatalf("Failed to record scan: %v", err)
+		}
+	}
+
+	days, err := store.DailyScans(qr.ID, day)
+	if err != nil {
+		t.Fatalf("Failed to count daily scans: %v", err)
+	}
+	if len(days) != 2 || !days[0].Day.Equal(day) || days[0].Count != 2 ||
+		!days[1].Day.Equal(day.AddDate(0, 0, 2)) || days[1].Count != 1 {
+		t.Errorf("Unexpected daily counts %+v", days)
+	}
+
+	devices, err := store.ScanCounts(qr.ID, day, ScanByDevice)
+	if err != nil {
+		t.Fatalf("Failed to count scans by device: %v", err)
+	}
+	if len(devices) != 2 || devices["mobile"] != 2 || devices["desktop"] != 1 {
+		t.Errorf("Unexpected device counts %v", devices)
+	}
+	referrers, err := store.ScanCounts(qr.ID, time.Time{}, ScanByReferrer)
+	if err != nil {
+		t.Fatalf("Failed to count scans by referrer: %v", err)
+	}
+	if referrers[""] != 3 || referrers["example.org"] != 1 {
+		t.Errorf("Unexpected referrer counts %v", referrers)
+	}
+	if _, err := store.ScanCounts(qr.ID, day, "ip_hash"); err == nil {
+		t.Error("Expected an error for an unknown dimension")
+	}
+
+	// Deleting the code deletes its scans.
+	if err := store.Delete(qr.ID); err != nil {
+		t.Fatalf("Failed to delete code: %v", err)
+	}
+	if days, err := store.DailyScans(qr.ID, time.Time{}); err != nil || len(days) != 0 {
+		t.Errorf("Expected scans to be deleted, got %+v %v", days, err)
+	}
+}
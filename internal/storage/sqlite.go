@@ -2,21 +2,111 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 type QRCode struct {
-	ID        int64
-	Content   string
-	Label     string
-	ImageData []byte
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int64
+	Content     string
+	Label       string
+	ECLevel     string
+	Foreground  string
+	Background  string
+	LogoID      int64
+	LogoPercent int
+	// Size is the pixel size of the stored PNG; Margin is the quiet zone in
+	// modules and Style the module shape. Together with the fields above they
+	// form the render spec the image can be regenerated from.
+	Size   int
+	Margin int
+	Style  string
+	// PayloadType names the structured payload Content was built from, if
+	// any, and PayloadData holds its fields as JSON so it can be edited.
+	PayloadType string
+	PayloadData string
+	// Campaign is the UTM campaign of a URL payload, kept apart from
+	// PayloadData so codes can be grouped by it.
+	Campaign string
+	// Verification records whether the stored image was decoded back to
+	// Content when it was generated.
+	Verification string
+	ImageData    []byte
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Logo is an uploaded image that can be placed in the centre of codes.
+type Logo struct {
+	ID          int64
+	Name        string
+	ContentType string
+	Data        []byte
+	CreatedAt   time.Time
+}
+
+// ErrNotFound is returned when an update or delete targets a missing code.
+var ErrNotFound = errors.New("qr code not found")
+
+// Defaults recorded for codes created without explicit render settings.
+const (
+	DefaultECLevel    = "M"
+	DefaultForeground = "#000000"
+	DefaultBackground = "#ffffff"
+	DefaultSize       = 256
+	DefaultMargin     = 4
+	DefaultStyle      = "square"
+)
+
+// Verification states for QRCode.Verification.
+const (
+	VerificationVerified   = "verified"
+	VerificationUnverified = "unverified"
+)
+
+// codeColumns lists the qr_codes metadata columns in the order of
+// QRCode.scanDest. The image blob is deliberately absent: it is only read
+// when a caller asks for it.
+const codeColumns = "id, content, label, ec_level, foreground, background, logo_id, logo_percent, " +
+	"size, margin, style, payload_type, payload_data, campaign, verification, created_at, updated_at"
+
+// columnMigrations adds columns introduced after the initial schema, so
+// databases created by older releases pick them up on start.
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"qr_codes", "ec_level", "TEXT NOT NULL DEFAULT 'M'"},
+	{"qr_codes", "foreground", "TEXT NOT NULL DEFAULT '#000000'"},
+	{"qr_codes", "background", "TEXT NOT NULL DEFAULT '#ffffff'"},
+	{"qr_codes", "logo_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"qr_codes", "logo_percent", "INTEGER NOT NULL DEFAULT 0"},
+	{"qr_codes", "verification", "TEXT NOT NULL DEFAULT 'unverified'"},
+	{"qr_codes", "size", "INTEGER NOT NULL DEFAULT 256"},
+	{"qr_codes", "margin", "INTEGER NOT NULL DEFAULT 4"},
+	{"qr_codes", "style", "TEXT NOT NULL DEFAULT 'square'"},
+	{"qr_codes", "payload_type", "TEXT NOT NULL DEFAULT ''"},
+	{"qr_codes", "payload_data", "TEXT NOT NULL DEFAULT ''"},
+	{"qr_codes", "campaign", "TEXT NOT NULL DEFAULT ''"},
+	{"links", "starts_at", "DATETIME"},
+	{"links", "expires_at", "DATETIME"},
+	{"links", "max_scans", "INTEGER NOT NULL DEFAULT 0"},
+	{"links", "scan_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"links", "fallback", "TEXT NOT NULL DEFAULT ''"},
+	{"links", "passphrase_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"links", "rules", "TEXT NOT NULL DEFAULT ''"},
+}
+
+func (qr *QRCode) scanDest() []any {
+	return []any{&qr.ID, &qr.Content, &qr.Label, &qr.ECLevel, &qr.Foreground, &qr.Background,
+		&qr.LogoID, &qr.LogoPercent, &qr.Size, &qr.Margin, &qr.Style,
+		&qr.PayloadType, &qr.PayloadData, &qr.Campaign, &qr.Verification,
+		&qr.CreatedAt, &qr.UpdatedAt}
 }
 
 type Store struct {
@@ -30,7 +120,9 @@ func New(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to create db directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Concurrent writers, such as simultaneous scans, wait for the write
+	// lock instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -58,34 +150,184 @@ func (s *Store) migrate() error {
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	CREATE INDEX IF NOT EXISTS idx_created_at ON qr_codes(created_at DESC);
+	CREATE TABLE IF NOT EXISTS logos (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		data BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS links (
+		code_id INTEGER PRIMARY KEY,
+		slug TEXT NOT NULL,
+		target TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_links_slug ON links(slug);
+	CREATE TABLE IF NOT EXISTS scans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code_id INTEGER NOT NULL,
+		scanned_at DATETIME NOT NULL,
+		client TEXT NOT NULL,
+		device TEXT NOT NULL,
+		referrer TEXT NOT NULL DEFAULT '',
+		ip_hash TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_scans_code ON scans(code_id, scanned_at);
+	CREATE TABLE IF NOT EXISTS rule_hits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code_id INTEGER NOT NULL,
+		hit_at DATETIME NOT NULL,
+		rule TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_rule_hits_code ON rule_hits(code_id, hit_at);
+	CREATE TABLE IF NOT EXISTS utm_presets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		medium TEXT NOT NULL DEFAULT '',
+		campaign TEXT NOT NULL DEFAULT '',
+		term TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_utm_presets_name ON utm_presets(name);
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS code_tags (
+		code_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (code_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_code_tags_tag ON code_tags(tag_id);
+	CREATE TABLE IF NOT EXISTS collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS collection_codes (
+		collection_id INTEGER NOT NULL,
+		code_id INTEGER NOT NULL,
+		PRIMARY KEY (collection_id, code_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_collection_codes_code ON collection_codes(code_id);
 	`
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	for _, m := range columnMigrations {
+		exists, err := s.hasColumn(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	// Indexes on migrated columns can only be created once they exist.
+	_, err := s.db.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_payload_type ON qr_codes(payload_type);
+	CREATE INDEX IF NOT EXISTS idx_campaign ON qr_codes(campaign);
+	`)
 	return err
 }
 
+func (s *Store) hasColumn(table, column string) (exists bool, err error) {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 func (s *Store) Create(content string, label string, imageData []byte) (*QRCode, error) {
-	result, err := s.db.Exec(
-		"INSERT INTO qr_codes (content, label, image_data) VALUES (?, ?, ?)",
-		content, label, imageData,
+	return s.Insert(&QRCode{Content: content, Label: label, Margin: DefaultMargin, ImageData: imageData})
+}
+
+// Insert stores a new code from the populated fields of qr, with its tags,
+// and returns the saved row. ID and timestamps are assigned by the database.
+func (s *Store) Insert(qr *QRCode, tags ...string) (_ *QRCode, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx, &err)
+
+	id, err := insertCode(tx, qr)
+	if err != nil {
+		return nil, err
+	}
+	if err := setCodeTags(tx, id, tags); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit qr code: %w", err)
+	}
+	return s.GetByID(id)
+}
+
+// execer is the part of *sql.DB and *sql.Tx that inserts and updates need.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertCode(db execer, qr *QRCode) (int64, error) {
+	result, err := db.Exec(
+		`INSERT INTO qr_codes (content, label, ec_level, foreground, background, logo_id, logo_percent,
+			size, margin, style, payload_type, payload_data, campaign, verification, image_data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		qr.Content, qr.Label,
+		orDefault(qr.ECLevel, DefaultECLevel),
+		orDefault(qr.Foreground, DefaultForeground),
+		orDefault(qr.Background, DefaultBackground),
+		qr.LogoID, qr.LogoPercent,
+		sizeOrDefault(qr.Size), qr.Margin, orDefault(qr.Style, DefaultStyle),
+		qr.PayloadType, qr.PayloadData, qr.Campaign,
+		orDefault(qr.Verification, VerificationUnverified),
+		qr.ImageData,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert qr code: %w", err)
+		return 0, fmt.Errorf("failed to insert qr code: %w", err)
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
 	}
-
-	return s.GetByID(id)
+	return id, nil
 }
 
 func (s *Store) GetByID(id int64) (*QRCode, error) {
 	qr := &QRCode{}
-	err := s.db.QueryRow(
-		"SELECT id, content, label, image_data, created_at, updated_at FROM qr_codes WHERE id = ?",
-		id,
-	).Scan(&qr.ID, &qr.Content, &qr.Label, &qr.ImageData, &qr.CreatedAt, &qr.UpdatedAt)
+	err := s.db.QueryRow("SELECT "+codeColumns+", image_data FROM qr_codes WHERE id = ?", id).
+		Scan(append(qr.scanDest(), &qr.ImageData)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -95,14 +337,105 @@ func (s *Store) GetByID(id int64) (*QRCode, error) {
 	return qr, nil
 }
 
-func (s *Store) List(limit, offset int) (codes []*QRCode, err error) {
+// GetImage returns just the stored image of a code, or nil if it does not
+// exist.
+func (s *Store) GetImage(id int64) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow("SELECT image_data FROM qr_codes WHERE id = ?", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get qr image: %w", err)
+	}
+	return data, nil
+}
+
+// Filter narrows List and Count. The zero Filter matches every code.
+type Filter struct {
+	// PayloadType matches codes built from that payload type, or codes
+	// without a payload when it is PlainText.
+	PayloadType string
+	// Campaign matches codes of that UTM campaign.
+	Campaign string
+	// Tag matches codes carrying that tag.
+	Tag string
+	// CollectionID matches codes in that collection.
+	CollectionID int64
+}
+
+// PlainText is the Filter.PayloadType of codes with no structured payload.
+const PlainText = "text"
+
+// where returns the SQL condition and arguments for f.
+func (f Filter) where() (string, []any) {
+	conds := []string{"1 = 1"}
+	var args []any
+	switch f.PayloadType {
+	case "":
+	case PlainText:
+		conds = append(conds, "payload_type = ''")
+	default:
+		conds = append(conds, "payload_type = ?")
+		args = append(args, f.PayloadType)
+	}
+	if f.Campaign != "" {
+		conds = append(conds, "campaign = ?")
+		args = append(args, f.Campaign)
+	}
+	if f.Tag != "" {
+		conds = append(conds, "id IN (SELECT ct.code_id FROM code_tags ct JOIN tags t ON t.id = ct.tag_id WHERE t.name = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.CollectionID != 0 {
+		conds = append(conds, "id IN (SELECT code_id FROM collection_codes WHERE collection_id = ?)")
+		args = append(args, f.CollectionID)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// CampaignCount is a UTM campaign and the number of codes in it.
+type CampaignCount struct {
+	Name  string
+	Codes int
+}
+
+// Campaigns returns the UTM campaigns that codes are tagged with, by name.
+func (s *Store) Campaigns() (campaigns []CampaignCount, err error) {
+	rows, err := s.db.Query("SELECT campaign, COUNT(*) FROM qr_codes WHERE campaign != '' GROUP BY campaign ORDER BY campaign")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var c CampaignCount
+		if err := rows.Scan(&c.Name, &c.Codes); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign: %w", err)
+		}
+		campaigns = append(campaigns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// List returns the codes matching f, newest first. Only metadata is loaded;
+// ImageData is left nil, use GetImage to fetch a code's image.
+func (s *Store) List(f Filter, limit, offset int) (codes []*QRCode, err error) {
 	if limit <= 0 {
 		limit = 50
 	}
 
+	where, args := f.where()
 	rows, err := s.db.Query(
-		"SELECT id, content, label, image_data, created_at, updated_at FROM qr_codes ORDER BY created_at DESC LIMIT ? OFFSET ?",
-		limit, offset,
+		"SELECT "+codeColumns+" FROM qr_codes WHERE "+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list qr codes: %w", err)
@@ -115,7 +448,7 @@ func (s *Store) List(limit, offset int) (codes []*QRCode, err error) {
 
 	for rows.Next() {
 		qr := &QRCode{}
-		if err := rows.Scan(&qr.ID, &qr.Content, &qr.Label, &qr.ImageData, &qr.CreatedAt, &qr.UpdatedAt); err != nil {
+		if err := rows.Scan(qr.scanDest()...); err != nil {
 			return nil, fmt.Errorf("failed to scan qr code: %w", err)
 		}
 		codes = append(codes, qr)
@@ -126,6 +459,105 @@ func (s *Store) List(limit, offset int) (codes []*QRCode, err error) {
 	return codes, nil
 }
 
+// Count returns the number of codes matching f.
+func (s *Store) Count(f Filter) (int, error) {
+	var n int
+	where, args := f.where()
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM qr_codes WHERE "+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count qr codes: %w", err)
+	}
+	return n, nil
+}
+
+// CodeChanges are the parts of a code besides its own row that UpdateCode
+// replaces. Nil fields are left unchanged; all but Tags need a dynamic code.
+// Replacing Limits keeps the scan count, so raising MaxScans reactivates an
+// exhausted link, and an empty PassphraseHash removes the protection.
+type CodeChanges struct {
+	Target         *string
+	Limits         *LinkLimits
+	PassphraseHash *string
+	Rules          *string
+	Tags           *[]string
+}
+
+// UpdateCode overwrites the content, label, render settings and image of an
+// existing code and applies changes to its link and tags, all in one
+// transaction, so a failure leaves the code as it was. It returns ErrNotFound if the code, or a link that changes need,
+// does not exist.
+func (s *Store) UpdateCode(qr *QRCode, changes CodeChanges) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx, &err)
+
+	if err := updateCode(tx, qr); err != nil {
+		return err
+	}
+	if changes.Target != nil {
+		if err := updateLink(tx, qr.ID, "target = ?", *changes.Target); err != nil {
+			return err
+		}
+	}
+	if changes.Limits != nil {
+		err := updateLink(tx, qr.ID, "starts_at = ?, expires_at = ?, max_scans = ?, fallback = ?", changes.Limits.limitArgs()...)
+		if err != nil {
+			return err
+		}
+	}
+	if changes.PassphraseHash != nil {
+		if err := updateLink(tx, qr.ID, "passphrase_hash = ?", *changes.PassphraseHash); err != nil {
+			return err
+		}
+	}
+	if changes.Rules != nil {
+		if err := updateLink(tx, qr.ID, "rules = ?", *changes.Rules); err != nil {
+			return err
+		}
+	}
+	if changes.Tags != nil {
+		if err := replaceCodeTags(tx, qr.ID, *changes.Tags); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit update: %w", err)
+	}
+	return nil
+}
+
+func updateCode(db execer, qr *QRCode) error {
+	result, err := db.Exec(
+		`UPDATE qr_codes SET content = ?, label = ?, ec_level = ?, foreground = ?, background = ?,
+			logo_id = ?, logo_percent = ?, size = ?, margin = ?, style = ?,
+			payload_type = ?, payload_data = ?, campaign = ?, verification = ?, image_data = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		qr.Content, qr.Label,
+		orDefault(qr.ECLevel, DefaultECLevel),
+		orDefault(qr.Foreground, DefaultForeground),
+		orDefault(qr.Background, DefaultBackground),
+		qr.LogoID, qr.LogoPercent,
+		sizeOrDefault(qr.Size), qr.Margin, orDefault(qr.Style, DefaultStyle),
+		qr.PayloadType, qr.PayloadData, qr.Campaign,
+		orDefault(qr.Verification, VerificationUnverified),
+		qr.ImageData,
+		qr.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update qr code: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (s *Store) UpdateLabel(id int64, label string) error {
 	result, err := s.db.Exec(
 		"UPDATE qr_codes SET label = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
@@ -140,13 +572,37 @@ func (s *Store) UpdateLabel(id int64, label string) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rows == 0 {
-		return fmt.Errorf("qr code not found")
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (s *Store) Delete(id int64) error {
-	result, err := s.db.Exec("DELETE FROM qr_codes WHERE id = ?", id)
+func (s *Store) Delete(id int64) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx, &err)
+
+	if _, err := tx.Exec("DELETE FROM scans WHERE code_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete scans: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM rule_hits WHERE code_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete rule hits: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM links WHERE code_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete link: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM code_tags WHERE code_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM code_tags)"); err != nil {
+		return fmt.Errorf("failed to drop unused tags: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM collection_codes WHERE code_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete collection entries: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM qr_codes WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete qr code: %w", err)
 	}
@@ -156,11 +612,93 @@ func (s *Store) Delete(id int64) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rows == 0 {
-		return fmt.Errorf("qr code not found")
+		return ErrNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
 	}
 	return nil
 }
 
+func (s *Store) CreateLogo(name, contentType string, data []byte) (*Logo, error) {
+	result, err := s.db.Exec(
+		"INSERT INTO logos (name, content_type, data) VALUES (?, ?, ?)",
+		name, contentType, data,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert logo: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	return s.GetLogo(id)
+}
+
+func (s *Store) GetLogo(id int64) (*Logo, error) {
+	logo := &Logo{}
+	err := s.db.QueryRow(
+		"SELECT id, name, content_type, data, created_at FROM logos WHERE id = ?",
+		id,
+	).Scan(&logo.ID, &logo.Name, &logo.ContentType, &logo.Data, &logo.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logo: %w", err)
+	}
+	return logo, nil
+}
+
+// ListLogos returns all logos, newest first, without their image data.
+func (s *Store) ListLogos() (logos []*Logo, err error) {
+	rows, err := s.db.Query("SELECT id, name, content_type, created_at FROM logos ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logos: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		logo := &Logo{}
+		if err := rows.Scan(&logo.ID, &logo.Name, &logo.ContentType, &logo.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan logo: %w", err)
+		}
+		logos = append(logos, logo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate logos: %w", err)
+	}
+	return logos, nil
+}
+
+// rollback undoes tx unless it was committed, reporting a failure through
+// err if nothing else went wrong first.
+func rollback(tx *sql.Tx, err *error) {
+	if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) && *err == nil {
+		*err = fmt.Errorf("failed to roll back: %w", rbErr)
+	}
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func sizeOrDefault(size int) int {
+	if size <= 0 {
+		return DefaultSize
+	}
+	return size
+}
+
 func (s *Store) Close() error {
 	return s.db.Close()
 }
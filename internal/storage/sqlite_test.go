@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -46,6 +48,12 @@ func TestStore(t *testing.T) {
 	if qr.Label != "Test Label" {
 		t.Errorf("Expected label 'Test Label', got '%s'", qr.Label)
 	}
+	if qr.ECLevel != DefaultECLevel {
+		t.Errorf("Expected default level '%s', got '%s'", DefaultECLevel, qr.ECLevel)
+	}
+	if qr.Verification != VerificationUnverified {
+		t.Errorf("Expected verification '%s', got '%s'", VerificationUnverified, qr.Verification)
+	}
 
 	// Test GetByID
 	retrieved, err := store.GetByID(qr.ID)
@@ -77,7 +85,7 @@ func TestStore(t *testing.T) {
 		t.Fatalf("Failed to create QR code: %v", err)
 	}
 
-	codes, err := store.List(10, 0)
+	codes, err := store.List(Filter{}, 10, 0)
 	if err != nil {
 		t.Fatalf("Failed to list QR codes: %v", err)
 	}
@@ -86,7 +94,7 @@ func TestStore(t *testing.T) {
 	}
 
 	// Test List with limit
-	codes, err = store.List(2, 0)
+	codes, err = store.List(Filter{}, 2, 0)
 	if err != nil {
 		t.Fatalf("Failed to list QR codes: %v", err)
 	}
@@ -161,3 +169,300 @@ func TestStoreCreateDirectory(t *testing.T) {
 		t.Error("Expected directory to be created")
 	}
 }
+
+func TestStoreInsertLevel(t *testing.T) {
+	store := newTestStore(t)
+
+	qr, err := store.Insert(&QRCode{Content: "content", ECLevel: "H", ImageData: []byte("data")})
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+
+	retrieved, err := store.GetByID(qr.ID)
+	if err != nil {
+		t.Fatalf("Failed to get QR code: %v", err)
+	}
+	if retrieved.ECLevel != "H" {
+		t.Errorf("Expected level 'H', got '%s'", retrieved.ECLevel)
+	}
+}
+
+func TestStoreMigratesOldSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// Schema as shipped before ec_level existed
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE qr_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			content TEXT NOT NULL,
+			label TEXT DEFAULT '',
+			image_data BLOB NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO qr_codes (content, image_data) VALUES ('legacy', x'00');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+
+	store, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open store on old schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("Failed to close store: %v", err)
+		}
+	})
+
+	codes, err := store.List(Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 1 || codes[0].ECLevel != DefaultECLevel {
+		t.Errorf("Expected legacy row with default level, got %+v", codes)
+	}
+	legacy := codes[0]
+	if legacy.Size != DefaultSize || legacy.Margin != DefaultMargin || legacy.Style != DefaultStyle {
+		t.Errorf("Expected default render spec, got size %d margin %d style %q", legacy.Size, legacy.Margin, legacy.Style)
+	}
+}
+
+func TestStoreRenderSpec(t *testing.T) {
+	store := newTestStore(t)
+
+	qr, err := store.Insert(&QRCode{Content: "spec", Size: 512, Margin: 0, Style: "dots", ImageData: []byte("png")})
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+	if qr.Size != 512 || qr.Margin != 0 || qr.Style != "dots" {
+		t.Errorf("Expected size 512 margin 0 style dots, got %d %d %q", qr.Size, qr.Margin, qr.Style)
+	}
+
+	qr.Size = 0
+	qr.Margin = 2
+	if err := store.UpdateCode(qr, CodeChanges{}); err != nil {
+		t.Fatalf("Failed to update QR code: %v", err)
+	}
+	updated, err := store.GetByID(qr.ID)
+	if err != nil {
+		t.Fatalf("Failed to get QR code: %v", err)
+	}
+	if updated.Size != DefaultSize || updated.Margin != 2 || updated.Style != "dots" {
+		t.Errorf("Expected size %d margin 2 style dots, got %d %d %q", DefaultSize, updated.Size, updated.Margin, updated.Style)
+	}
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("Failed to close store: %v", err)
+		}
+	})
+	return store
+}
+
+func TestStoreLogos(t *testing.T) {
+	store := newTestStore(t)
+
+	logo, err := store.CreateLogo("Acme", "image/png", []byte("png-data"))
+	if err != nil {
+		t.Fatalf("Failed to create logo: %v", err)
+	}
+	if logo.ID == 0 || logo.Name != "Acme" || logo.ContentType != "image/png" {
+		t.Errorf("Unexpected logo %+v", logo)
+	}
+
+	retrieved, err := store.GetLogo(logo.ID)
+	if err != nil {
+		t.Fatalf("Failed to get logo: %v", err)
+	}
+	if string(retrieved.Data) != "png-data" {
+		t.Error("Logo data mismatch")
+	}
+
+	notFound, err := store.GetLogo(99999)
+	if err != nil || notFound != nil {
+		t.Errorf("Expected nil logo for non-existent ID, got %v (%v)", notFound, err)
+	}
+
+	logos, err := store.ListLogos()
+	if err != nil {
+		t.Fatalf("Failed to list logos: %v", err)
+	}
+	if len(logos) != 1 || logos[0].Data != nil {
+		t.Errorf("Expected one logo without data, got %+v", logos)
+	}
+
+	qr, err := store.Insert(&QRCode{Content: "content", LogoID: logo.ID, LogoPercent: 15, ImageData: []byte("data")})
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+	if qr.LogoID != logo.ID || qr.LogoPercent != 15 {
+		t.Errorf("Expected logo %d at 15%%, got %d at %d%%", logo.ID, qr.LogoID, qr.LogoPercent)
+	}
+}
+
+func TestStoreFilter(t *testing.T) {
+	store := newTestStore(t)
+
+	for _, typ := range []string{"", "wifi", "wifi", "sms"} {
+		if _, err := store.Insert(&QRCode{Content: "x", PayloadType: typ, ImageData: []byte("png")}); err != nil {
+			t.Fatalf("Failed to insert QR code: %v", err)
+		}
+	}
+
+	for filter, want := range map[string]int{"": 4, "wifi": 2, "sms": 1, PlainText: 1, "geo": 0} {
+		codes, err := store.List(Filter{PayloadType: filter}, 10, 0)
+		if err != nil {
+			t.Fatalf("Failed to list QR codes: %v", err)
+		}
+		n, err := store.Count(Filter{PayloadType: filter})
+		if err != nil {
+			t.Fatalf("Failed to count QR codes: %v", err)
+		}
+		if len(codes) != want || n != want {
+			t.Errorf("Filter %q: expected %d codes, listed %d and counted %d", filter, want, len(codes), n)
+		}
+	}
+}
+
+func TestStoreListOmitsImages(t *testing.T) {
+	store := newTestStore(t)
+
+	qr, err := store.Create("content", "", []byte("image-data"))
+	if err != nil {
+		t.Fatalf("Failed to create QR code: %v", err)
+	}
+
+	codes, err := store.List(Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 1 || codes[0].ImageData != nil {
+		t.Errorf("Expected one code without image data, got %+v", codes)
+	}
+
+	image, err := store.GetImage(qr.ID)
+	if err != nil {
+		t.Fatalf("Failed to get image: %v", err)
+	}
+	if string(image) != "image-data" {
+		t.Errorf("Expected image data, got %q", image)
+	}
+
+	image, err = store.GetImage(99999)
+	if err != nil || image != nil {
+		t.Errorf("Expected nil image for non-existent ID, got %q (%v)", image, err)
+	}
+}
+
+// BenchmarkList compares loading a page of the history with and without the
+// image blobs on a 10k-row database. Run with:
+//
+//	go test -run '^$' -bench BenchmarkList -benchmem ./internal/storage
+func BenchmarkList(b *testing.B) {
+	store, err := New(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("Failed to create store: %v", err)
+	}
+	b.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			b.Errorf("Failed to close store: %v", err)
+		}
+	})
+
+	// A 256px PNG is typically 1-2 KB.
+	image := make([]byte, 1500)
+	tx, err := store.db.Begin()
+	if err != nil {
+		b.Fatalf("Failed to begin transaction: %v", err)
+	}
+	for i := 0; i < 10000; i++ {
+		if _, err := tx.Exec(
+			"INSERT INTO qr_codes (content, image_data) VALUES (?, ?)",
+			fmt.Sprintf("https://example.com/%d", i), image,
+		); err != nil {
+			b.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatalf("Failed to commit: %v", err)
+	}
+
+	b.Run("metadata", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := store.List(Filter{}, 100, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// The query List used before blobs were split out.
+	b.Run("with_blobs", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := store.db.Query(
+				"SELECT "+codeColumns+", image_data FROM qr_codes ORDER BY created_at DESC LIMIT ? OFFSET ?",
+				100, 0,
+			)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for rows.Next() {
+				qr := &QRCode{}
+				if err := rows.Scan(append(qr.scanDest(), &qr.ImageData)...); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := rows.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestStoreCampaigns(t *testing.T) {
+	store := newTestStore(t)
+
+	for _, campaign := range []string{"spring", "spring", "autumn", ""} {
+		if _, err := store.Insert(&QRCode{Content: "x", PayloadType: "url", Campaign: campaign, ImageData: []byte("png")}); err != nil {
+			t.Fatalf("Failed to insert QR code: %v", err)
+		}
+	}
+
+	campaigns, err := store.Campaigns()
+	if err != nil {
+		t.Fatalf("Failed to list campaigns: %v", err)
+	}
+	want := []CampaignCount{{"autumn", 1}, {"spring", 2}}
+	if len(campaigns) != len(want) || campaigns[0] != want[0] || campaigns[1] != want[1] {
+		t.Errorf("Expected campaigns %v, got %v", want, campaigns)
+	}
+
+	codes, err := store.List(Filter{PayloadType: "url", Campaign: "spring"}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 2 || codes[0].Campaign != "spring" {
+		t.Errorf("Expected the 2 spring codes, got %d", len(codes))
+	}
+	if n, _ := store.Count(Filter{Campaign: "winter"}); n != 0 {
+		t.Errorf("Expected no winter codes, got %d", n)
+	}
+}
@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TagCount is a tag and the number of codes that carry it.
+type TagCount struct {
+	Name  string
+	Codes int
+}
+
+// Collection is a named group of codes. A code can be in any number of
+// collections.
+type Collection struct {
+	ID        int64
+	Name      string
+	Codes     int
+	CreatedAt time.Time
+}
+
+var (
+	// ErrCollectionNotFound is returned when a collection does not exist.
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionExists is returned when a collection name is already in
+	// use.
+	ErrCollectionExists = errors.New("collection name is already in use")
+)
+
+// inList returns a placeholder list and arguments for an SQL IN clause.
+func inList(ids []int64) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// codeExists reports whether a code with the given ID exists.
+func codeExists(db *sql.Tx, id int64) (bool, error) {
+	var one int
+	err := db.QueryRow("SELECT 1 FROM qr_codes WHERE id = ?", id).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get qr code: %w", err)
+	}
+	return true, nil
+}
+
+// replaceCodeTags replaces the tags of a code within tx and drops tags no
+// code carries any more.
+func replaceCodeTags(tx *sql.Tx, codeID int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM code_tags WHERE code_id = ?", codeID); err != nil {
+		return fmt.Errorf("failed to clear tags: %w", err)
+	}
+	if err := setCodeTags(tx, codeID, tags); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM code_tags)"); err != nil {
+		return fmt.Errorf("failed to drop unused tags: %w", err)
+	}
+	return nil
+}
+
+// setCodeTags adds tags to a code within tx, creating tags that do not
+// exist yet.
+func setCodeTags(tx *sql.Tx, codeID int64, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return fmt.Errorf("failed to insert tag: %w", err)
+		}
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO code_tags (code_id, tag_id) SELECT ?, id FROM tags WHERE name = ?",
+			codeID, tag,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to tag code: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListCodeTags returns the tags of the given codes by name, keyed by code ID.
+// Codes without tags have no entry.
+func (s *Store) ListCodeTags(codeIDs []int64) (tags map[int64][]string, err error) {
+	tags = make(map[int64][]string)
+	if len(codeIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders, args := inList(codeIDs)
+	rows, err := s.db.Query(
+		"SELECT ct.code_id, t.name FROM code_tags ct JOIN tags t ON t.id = ct.tag_id WHERE ct.code_id IN ("+placeholders+") ORDER BY t.name",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list code tags: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan code tag: %w", err)
+		}
+		tags[id] = append(tags[id], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate code tags: %w", err)
+	}
+	return tags, nil
+}
+
+// Tags returns every tag in use with its number of codes, by name.
+func (s *Store) Tags() (tags []TagCount, err error) {
+	rows, err := s.db.Query("SELECT t.name, COUNT(*) FROM tags t JOIN code_tags ct ON ct.tag_id = t.id GROUP BY t.id ORDER BY t.name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Name, &t.Codes); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tags: %w", err)
+	}
+	return tags, nil
+}
+
+// collectionColumns selects a collection with its number of codes.
+const collectionColumns = "c.id, c.name, (SELECT COUNT(*) FROM collection_codes cc WHERE cc.collection_id = c.id), c.created_at"
+
+func (c *Collection) scanDest() []any {
+	return []any{&c.ID, &c.Name, &c.Codes, &c.CreatedAt}
+}
+
+// CreateCollection stores a new, empty collection. It returns
+// ErrCollectionExists if another collection has the same name.
+func (s *Store) CreateCollection(name string) (*Collection, error) {
+	result, err := s.db.Exec("INSERT INTO collections (name) VALUES (?)", name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrCollectionExists
+		}
+		return nil, fmt.Errorf("failed to insert collection: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	return s.GetCollection(id)
+}
+
+// GetCollection returns a collection, or nil if it does not exist.
+func (s *Store) GetCollection(id int64) (*Collection, error) {
+	c := &Collection{}
+	err := s.db.QueryRow("SELECT "+collectionColumns+" FROM collections c WHERE c.id = ?", id).Scan(c.scanDest()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+	return c, nil
+}
+
+// ListCollections returns all collections by name.
+func (s *Store) ListCollections() (collections []*Collection, err error) {
+	rows, err := s.db.Query("SELECT " + collectionColumns + " FROM collections c ORDER BY c.name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		c := &Collection{}
+		if err := rows.Scan(c.scanDest()...); err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate collections: %w", err)
+	}
+	return collections, nil
+}
+
+// RenameCollection changes the name of a collection.
+func (s *Store) RenameCollection(id int64, name string) error {
+	result, err := s.db.Exec("UPDATE collections SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrCollectionExists
+		}
+		return fmt.Errorf("failed to rename collection: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+// DeleteCollection removes a collection. Its codes are kept.
+func (s *Store) DeleteCollection(id int64) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx, &err)
+
+	if _, err := tx.Exec("DELETE FROM collection_codes WHERE collection_id = ?", id); err != nil {
+		return fmt.Errorf("failed to empty collection: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM collections WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrCollectionNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
+	}
+	return nil
+}
+
+// AddToCollection puts a code in a collection; adding it again does nothing.
+// It returns ErrCollectionNotFound or ErrNotFound if either does not exist.
+func (s *Store) AddToCollection(collectionID, codeID int64) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx, &err)
+
+	var one int
+	err = tx.QueryRow("SELECT 1 FROM collections WHERE id = ?", collectionID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return ErrCollectionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+	exists, err := codeExists(tx, codeID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO collection_codes (collection_id, code_id) VALUES (?, ?)", collectionID, codeID)
+	if err != nil {
+		return fmt.Errorf("failed to add code to collection: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit collection: %w", err)
+	}
+	return nil
+}
+
+// RemoveFromCollection takes a code out of a collection. It returns
+// ErrNotFound if the code is not in it.
+func (s *Store) RemoveFromCollection(collectionID, codeID int64) error {
+	result, err := s.db.Exec("DELETE FROM collection_codes WHERE collection_id = ? AND code_id = ?", collectionID, codeID)
+	if err != nil {
+		return fmt.Errorf("failed to remove code from collection: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListCodeCollections returns the IDs of the collections the given codes are
+// in, keyed by code ID. Codes in no collection have no entry.
+func (s *Store) ListCodeCollections(codeIDs []int64) (collections map[int64][]int64, err error) {
+	collections = make(map[int64][]int64)
+	if len(codeIDs) == 0 {
+		return collections, nil
+	}
+
+	placeholders, args := inList(codeIDs)
+	rows, err := s.db.Query(
+		"SELECT code_id, collection_id FROM collection_codes WHERE code_id IN ("+placeholders+") ORDER BY collection_id",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list code collections: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close rows: %w", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var codeID, collectionID int64
+		if err := rows.Scan(&codeID, &collectionID); err != nil {
+			return nil, fmt.Errorf("failed to scan code collection: %w", err)
+		}
+		collections[codeID] = append(collections[codeID], collectionID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate code collections: %w", err)
+	}
+	return collections, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreTags(t *testing.T) {
+	store := newTestStore(t)
+
+	var codes []*QRCode
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		code, err := store.Insert(&QRCode{Content: "x", ImageData: []byte("png")})
+		if err != nil {
+			t.Fatalf("Failed to insert QR code: %v", err)
+		}
+		codes = append(codes, code)
+		ids = append(ids, code.ID)
+	}
+	tag := func(code *QRCode, tags ...string) error {
+		return store.UpdateCode(code, CodeChanges{Tags: &tags})
+	}
+	if err := tag(codes[0], "print", "spring"); err != nil {
+		t.Fatalf("Failed to tag code: %v", err)
+	}
+	if err := tag(codes[1], "print"); err != nil {
+		t.Fatalf("Failed to tag code: %v", err)
+	}
+	if err := tag(&QRCode{ID: 9999}, "print"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	tags, err := store.Tags()
+	if err != nil {
+		t.Fatalf("Failed to list tags: %v", err)
+	}
+	want := []TagCount{{"print", 2}, {"spring", 1}}
+	if len(tags) != len(want) || tags[0] != want[0] || tags[1] != want[1] {
+		t.Errorf("Expected tags %v, got %v", want, tags)
+	}
+	codeTags, err := store.ListCodeTags(ids)
+	if err != nil {
+		t.Fatalf("Failed to list code tags: %v", err)
+	}
+	if len(codeTags) != 2 || len(codeTags[ids[0]]) != 2 || codeTags[ids[1]][0] != "print" {
+		t.Errorf("Unexpected code tags %v", codeTags)
+	}
+	if n, _ := store.Count(Filter{Tag: "print"}); n != 2 {
+		t.Errorf("Expected 2 print codes, got %d", n)
+	}
+
+	// Tags no code carries are dropped
+	if err := tag(codes[0], "print"); err != nil {
+		t.Fatalf("Failed to tag code: %v", err)
+	}
+	if err := store.Delete(ids[1]); err != nil {
+		t.Fatalf("Failed to delete QR code: %v", err)
+	}
+	if tags, _ := store.Tags(); len(tags) != 1 || tags[0] != (TagCount{"print", 1}) {
+		t.Errorf("Expected only print on 1 code, got %v", tags)
+	}
+}
+
+func TestStoreInsertWithTags(t *testing.T) {
+	store := newTestStore(t)
+
+	code, err := store.Insert(&QRCode{Content: "x", ImageData: []byte("png")}, "print", "spring")
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+	link := &Link{Slug: "menu", Target: "https://example.com"}
+	dynamic, err := store.InsertDynamic(&QRCode{Content: "y", ImageData: []byte("png")}, link, "print")
+	if err != nil {
+		t.Fatalf("Failed to insert dynamic code: %v", err)
+	}
+	tags, err := store.ListCodeTags([]int64{code.ID, dynamic.ID})
+	if err != nil {
+		t.Fatalf("Failed to list code tags: %v", err)
+	}
+	if len(tags[code.ID]) != 2 || len(tags[dynamic.ID]) != 1 {
+		t.Errorf("Expected the tags to be stored with the codes, got %v", tags)
+	}
+
+	// A failed insert leaves neither the code nor its tags behind.
+	taken := &Link{Slug: "menu", Target: "https://example.com"}
+	if _, err := store.InsertDynamic(&QRCode{Content: "z", ImageData: []byte("png")}, taken, "autumn"); !errors.Is(err, ErrSlugTaken) {
+		t.Fatalf("Expected ErrSlugTaken, got %v", err)
+	}
+	if n, _ := store.Count(Filter{}); n != 2 {
+		t.Errorf("Expected 2 codes, got %d", n)
+	}
+	if n, _ := store.Count(Filter{Tag: "autumn"}); n != 0 {
+		t.Errorf("Expected no autumn codes, got %d", n)
+	}
+}
+
+func TestStoreCollections(t *testing.T) {
+	store := newTestStore(t)
+
+	a, err := store.Insert(&QRCode{Content: "a", ImageData: []byte("png")})
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+	b, err := store.Insert(&QRCode{Content: "b", ImageData: []byte("png")})
+	if err != nil {
+		t.Fatalf("Failed to insert QR code: %v", err)
+	}
+
+	menus, err := store.CreateCollection("menus")
+	if err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if menus.ID == 0 || menus.Name != "menus" || menus.CreatedAt.IsZero() {
+		t.Errorf("Unexpected collection %+v", menus)
+	}
+	events, err := store.CreateCollection("events")
+	if err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if _, err := store.CreateCollection("menus"); !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+	if err := store.RenameCollection(events.ID, "menus"); !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists on rename, got %v", err)
+	}
+	if err := store.RenameCollection(9999, "x"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+
+	for _, add := range [][2]int64{{menus.ID, a.ID}, {menus.ID, b.ID}, {menus.ID, a.ID}, {events.ID, a.ID}} {
+		if err := store.AddToCollection(add[0], add[1]); err != nil {
+			t.Fatalf("Failed to add to collection: %v", err)
+		}
+	}
+	if err := store.AddToCollection(9999, a.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	if err := store.AddToCollection(menus.ID, 9999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	collections, err := store.ListCollections()
+	if err != nil {
+		t.Fatalf("Failed to list collections: %v", err)
+	}
+	if len(collections) != 2 || collections[0].Name != "events" || collections[1].Codes != 2 {
+		t.Errorf("Unexpected collections %+v", collections)
+	}
+	codes, err := store.List(Filter{CollectionID: events.ID}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list QR codes: %v", err)
+	}
+	if len(codes) != 1 || codes[0].ID != a.ID {
+		t.Errorf("Expected code a in events, got %d codes", len(codes))
+	}
+	in, err := store.ListCodeCollections([]int64{a.ID, b.ID})
+	if err != nil {
+		t.Fatalf("Failed to list code collections: %v", err)
+	}
+	if len(in[a.ID]) != 2 || len(in[b.ID]) != 1 {
+		t.Errorf("Unexpected code collections %v", in)
+	}
+
+	if err := store.RemoveFromCollection(menus.ID, b.ID); err != nil {
+		t.Fatalf("Failed to remove from collection: %v", err)
+	}
+	if err := store.RemoveFromCollection(menus.ID, b.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.DeleteCollection(menus.ID); err != nil {
+		t.Fatalf("Failed to delete collection: %v", err)
+	}
+	if err := store.DeleteCollection(menus.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	if got, _ := store.GetByID(a.ID); got == nil {
+		t.Error("Expected the codes to outlive their collection")
+	}
+	if in, _ := store.ListCodeCollections([]int64{a.ID}); len(in[a.ID]) != 1 || in[a.ID][0] != events.ID {
+		t.Errorf("Expected a to stay in events only, got %v", in)
+	}
+}